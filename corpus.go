@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// runCorpus prints which samples in the corpus each rule which would be tested matched, followed by how many rules matched anything
+func runCorpus(r *runner.Runner, paths []string, corpus string, w io.Writer) (bool, error) {
+	report, err := r.RunCorpus(paths, corpus)
+	if err != nil {
+		return false, err
+	}
+	matched, valid := 0, true
+	for _, result := range report.Results {
+		switch {
+		case result.Error != "":
+			valid = false
+			fmt.Fprintf(w, "%s: error: %s\n", result.Name(), result.Error)
+		case len(result.Matches) == 0:
+			fmt.Fprintf(w, "%s: no matches\n", result.Name())
+		default:
+			matched++
+			fmt.Fprintf(w, "%s: matched %d samples\n", result.Name(), len(result.Matches))
+		}
+		for _, sample := range result.Matches {
+			fmt.Fprintf(w, "    %s\n", sample)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d rules matched at least one of %d samples\n", matched, len(report.Results), report.Samples)
+	return valid, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// coverageFile is the format of the -coverage-out file, intended for tracking coverage over time
+type coverageFile struct {
+	Rules   []ruleCoverage  `json:"rules"`
+	Overall overallCoverage `json:"overall"`
+}
+
+type ruleCoverage struct {
+	ID          string   `json:"id,omitempty"`
+	Path        string   `json:"path"`
+	Rule        string   `json:"rule,omitempty"` // identifies the rule within a rule collection
+	Fields      int      `json:"fields"`
+	Exercised   int      `json:"exercised"`
+	Unexercised []string `json:"unexercised"`
+}
+
+type overallCoverage struct {
+	Rules      int     `json:"rules"`
+	Fields     int     `json:"fields"`
+	Exercised  int     `json:"exercised"`
+	Percentage float64 `json:"percentage"`
+}
+
+// writeCoverage writes the coverage of every rule which has some (i.e. rules which were evaluated) as JSON
+func writeCoverage(path string, report runner.Report) error {
+	out := coverageFile{Rules: []ruleCoverage{}}
+	total := runner.FieldCoverage{}
+	for _, result := range report.Results {
+		if result.Coverage == nil {
+			continue
+		}
+		unexercised := result.Coverage.Unexercised
+		if unexercised == nil {
+			unexercised = []string{}
+		}
+		out.Rules = append(out.Rules, ruleCoverage{
+			ID:          result.ID,
+			Path:        result.Path,
+			Rule:        result.Rule,
+			Fields:      result.Coverage.Fields,
+			Exercised:   result.Coverage.Exercised,
+			Unexercised: unexercised,
+		})
+		total.Fields += result.Coverage.Fields
+		total.Exercised += result.Coverage.Exercised
+	}
+	out.Overall = overallCoverage{
+		Rules:      len(out.Rules),
+		Fields:     total.Fields,
+		Exercised:  total.Exercised,
+		Percentage: total.Percentage(),
+	}
+
+	contents, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding coverage: %w", err)
+	}
+	if err := os.WriteFile(path, append(contents, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing coverage: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
 )
 
 func TestExamples(t *testing.T) {
@@ -14,15 +16,19 @@ func TestExamples(t *testing.T) {
 
 		t.Run(path, func(t *testing.T) {
 			*fConfigFiles = "testdata/config.yaml"
-			configs, err := loadConfigs()
+			configs, _, err := loadConfigs()
 			if err != nil {
 				t.Fatal(err)
 			}
-			pass, err := run(path, configs, true)
+			out, _ := newReporter("table", os.Stdout)
+			// Test files, configs etc. are walked too but don't contain any rules
+			r := &runner.Runner{Configs: configs, Recursive: true, AllowEmpty: true, OnResult: out.Report}
+			report, err := r.Run([]string{path})
 			if err != nil {
 				t.Fatal(err)
 			}
-			if !pass {
+			out.Close()
+			if !report.Passed {
 				t.Fatal("Expected all test cases to pass")
 			}
 		})
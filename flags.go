@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+)
+
+// stringsFlag is a flag which can be specified multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles lists the files which differ from base (including uncommitted changes and untracked files) using git.
+// The paths are absolute as git reports them relative to the root of the repository rather than the working directory.
+func changedFiles(base string) ([]string, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := git("diff", "--name-only", base, "--")
+	if err != nil {
+		return nil, err
+	}
+	// New files which haven't been added yet aren't in the diff (ignored files are left out as they would be by git add)
+	untracked, err := git("ls-files", "--others", "--exclude-standard", "--full-name", "--", ":/")
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty (rather than nil) list means nothing changed so no rules should be tested
+	files := []string{}
+	for _, name := range strings.Split(diff+"\n"+untracked, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+func git(args ...string) (string, error) {
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitIgnoredFiles lists the untracked files and directories which git ignores (e.g. due to .gitignore).
+// Ignored directories are listed without their contents.
+func gitIgnoredFiles() ([]string, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := git("-C", root, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range strings.Split(ignored, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(strings.TrimSuffix(name, "/"))))
+		}
+	}
+	return files, nil
+}
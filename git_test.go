@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedFilesIncludesUntracked(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir()) // git reports the resolved path of the repository
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(args ...string) {
+		if _, err := git(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	write("rules/committed.yaml")
+	write(".gitignore")
+	run("add", ".")
+	run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial")
+
+	write("rules/committed.yaml") // unchanged contents
+	write("rules/new.yaml")
+	write("rules/ignored.yaml")
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run from a subdirectory as git reports untracked files relative to the working directory by default
+	if err := os.Chdir(filepath.Join(dir, "rules")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := changedFiles("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, ".gitignore"), filepath.Join(dir, "rules", "new.yaml")}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %v, got %v", expected, files)
+	}
+}
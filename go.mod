@@ -1,8 +1,16 @@
 module github.com/bradleyjkemp/sigma-test
 
-go 1.15
+go 1.21
 
 require (
 	github.com/bradleyjkemp/sigma-go v0.5.0
+	github.com/fsnotify/fsnotify v1.4.9
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
+
+require (
+	github.com/PaesslerAG/gval v1.0.0 // indirect
+	github.com/PaesslerAG/jsonpath v0.1.1 // indirect
+	github.com/alecthomas/participle v0.7.1 // indirect
+	golang.org/x/sys v0.0.0-20191005200804-aed5e4c7ecf9 // indirect
+)
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// lintTests prints the problems with the test files of the rules which would be tested, returning whether there weren't any
+func lintTests(r *runner.Runner, paths []string, w io.Writer) (bool, error) {
+	problems, err := r.LintTests(paths)
+	if err != nil {
+		return false, err
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(w, "%s: %s\n", problem.Path, problem.Problem)
+	}
+	return len(problems) == 0, nil
+}
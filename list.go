@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// listRules prints the files which would be tested along with their test files, without evaluating anything
+func listRules(r *runner.Runner, paths []string, w io.Writer) error {
+	files, err := r.Discover(paths)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	for _, file := range files {
+		switch {
+		case file.Type != sigma.RuleFile:
+			fileType := string(file.Type)
+			if fileType == "" {
+				fileType = "unknown"
+			}
+			fmt.Fprintf(tw, "%s\tnot a rule (%s)\t\n", file.Path, fileType)
+		case file.TestFile == "":
+			fmt.Fprintf(tw, "%s\tno test file\t\n", file.Path)
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%d test cases\n", file.Path, strings.Join(file.TestFiles, ", "), file.TestCases)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// A reporter receives the result of each rule as it is tested and formats them for output.
+// Close must be called once all results have been reported.
+type reporter interface {
+	Report(result runner.RuleResult) error
+	Close() error
+}
+
+func newReporter(format string, w io.Writer) (reporter, error) {
+	switch format {
+	case "table":
+		color, err := useColor(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tableReporter{w: tabwriter.NewWriter(w, 0, 0, 4, ' ', 0), color: color, maxFailures: *fMaxFailures, durations: *fTopSlow > 0}, nil
+	case "json":
+		return &jsonReporter{w: w}, nil
+	case "junit":
+		return &junitReporter{w: w}, nil
+	case "tap":
+		return &tapReporter{w: w}, nil
+	case "github":
+		return &githubReporter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+// summaryReporter wraps another reporter to count the number of rules with each status
+type summaryReporter struct {
+	reporter
+	statusCounts
+	coverage *runner.FieldCoverage // the total coverage of all rules (if coverage is enabled)
+
+	cases, failedCases int // the number of test cases run across all rules (regardless of their rule's status)
+	unknownCases       int // the number of test cases with an unknown expectation (counted as passing)
+
+	topSlow   int // the number of slowest rules to list
+	durations []ruleDuration
+
+	directories *directoryNode // the counts for each directory (if grouping by directory)
+}
+
+// statusCounts counts the number of rules with each status
+type statusCounts struct {
+	passed, failed, skipped, errored, unconfigured, untested int
+}
+
+func (c *statusCounts) add(status string) {
+	switch status {
+	case runner.StatusPass:
+		c.passed++
+	case runner.StatusFail:
+		c.failed++
+	case runner.StatusSkip:
+		c.skipped++
+	case runner.StatusError:
+		c.errored++
+	case runner.StatusUnconfigured:
+		c.unconfigured++
+	case runner.StatusUntested:
+		c.untested++
+	}
+}
+
+func (c statusCounts) String() string {
+	summary := fmt.Sprintf("%d passed, %d failed, %d skipped, %d errors", c.passed, c.failed, c.skipped, c.errored)
+	if c.unconfigured > 0 {
+		summary += fmt.Sprintf(", %d unconfigured", c.unconfigured)
+	}
+	if c.untested > 0 {
+		summary += fmt.Sprintf(", %d untested", c.untested)
+	}
+	return summary
+}
+
+func (c statusCounts) total() int {
+	return c.passed + c.failed + c.skipped + c.errored + c.unconfigured + c.untested
+}
+
+// directoryNode counts the statuses of the rules in a directory (including its subdirectories)
+type directoryNode struct {
+	statusCounts
+	children map[string]*directoryNode
+}
+
+// add counts a rule in the directory at path and each of its parents
+func (d *directoryNode) add(path, status string) {
+	node := d
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if part == "" {
+			part = "/" // the root of an absolute path
+		}
+		if node.children == nil {
+			node.children = map[string]*directoryNode{}
+		}
+		child, ok := node.children[part]
+		if !ok {
+			child = &directoryNode{}
+			node.children[part] = child
+		}
+		child.statusCounts.add(status)
+		node = child
+	}
+}
+
+// write adds a line for each directory to summary, with subdirectories indented below their parents.
+// Directories with a single subdirectory and no rules of their own are joined with it (e.g. rules/windows) to keep the tree short.
+func (d *directoryNode) write(summary *strings.Builder, depth int) {
+	var names []string
+	for name := range d.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := d.children[name]
+		for len(child.children) == 1 && child.total() == child.onlyChild().total() {
+			for childName, grandchild := range child.children {
+				name, child = filepath.ToSlash(filepath.Join(name, childName)), grandchild
+			}
+		}
+		fmt.Fprintf(summary, "\n%s%s: %s", strings.Repeat("  ", depth), name, child.statusCounts)
+		child.write(summary, depth+1)
+	}
+}
+
+func (d *directoryNode) onlyChild() *directoryNode {
+	for _, child := range d.children {
+		return child
+	}
+	return nil
+}
+
+type ruleDuration struct {
+	name     string
+	duration time.Duration
+}
+
+func (s *summaryReporter) Report(result runner.RuleResult) error {
+	s.statusCounts.add(result.Status)
+	if s.directories != nil {
+		s.directories.add(result.Path, result.Status)
+	}
+	if result.Coverage != nil {
+		if s.coverage == nil {
+			s.coverage = &runner.FieldCoverage{}
+		}
+		s.coverage.Fields += result.Coverage.Fields
+		s.coverage.Exercised += result.Coverage.Exercised
+	}
+	s.cases += len(result.Cases)
+	s.failedCases += len(result.Failures())
+	s.unknownCases += len(result.Unknown())
+	if s.topSlow > 0 {
+		s.durations = append(s.durations, ruleDuration{result.Name(), result.Duration})
+	}
+	return s.reporter.Report(result)
+}
+
+func (s *summaryReporter) String() string {
+	summary := s.statusCounts.String()
+	summary += fmt.Sprintf("\n%d test cases: %d passed, %d failed", s.cases, s.cases-s.failedCases, s.failedCases)
+	if s.unknownCases > 0 {
+		summary += fmt.Sprintf(" (%d with an unknown expectation)", s.unknownCases)
+	}
+	if s.coverage != nil {
+		summary += fmt.Sprintf("\n%.1f%% of detection fields covered overall", s.coverage.Percentage())
+	}
+	if s.topSlow > 0 && len(s.durations) > 0 {
+		sort.SliceStable(s.durations, func(i, j int) bool {
+			return s.durations[i].duration > s.durations[j].duration
+		})
+		slowest := s.durations
+		if len(slowest) > s.topSlow {
+			slowest = slowest[:s.topSlow]
+		}
+		summary += fmt.Sprintf("\nslowest %d rules:", len(slowest))
+		for _, rule := range slowest {
+			summary += fmt.Sprintf("\n%12v  %s", rule.duration.Round(time.Microsecond), rule.name)
+		}
+	}
+	if s.directories != nil && len(s.directories.children) > 0 {
+		tree := &strings.Builder{}
+		s.directories.write(tree, 1)
+		summary += "\nresults by directory:" + tree.String()
+	}
+	return summary
+}
+
+// quietReporter only passes on results which failed or errored
+type quietReporter struct {
+	reporter
+}
+
+func (q quietReporter) Report(result runner.RuleResult) error {
+	switch result.Status {
+	case runner.StatusPass, runner.StatusSkip, runner.StatusUnconfigured:
+		return nil
+	default:
+		return q.reporter.Report(result)
+	}
+}
+
+// discardReporter doesn't output any results (so that only the summary is printed)
+type discardReporter struct{}
+
+func (discardReporter) Report(runner.RuleResult) error { return nil }
+func (discardReporter) Close() error                   { return nil }
+
+type tableReporter struct {
+	w     *tabwriter.Writer
+	color bool
+
+	durations      bool // whether to show how long each rule took (only with -top-slow as it makes the output differ between runs)
+	maxFailures    int  // the number of failing test cases to print details of (0 means no limit)
+	failures       int
+	hiddenFailures int
+}
+
+// ANSI escape codes for the colour of each status
+var statusColors = map[string]string{
+	runner.StatusPass:         "\x1b[32m", // green
+	runner.StatusFail:         "\x1b[31m", // red
+	runner.StatusSkip:         "\x1b[33m", // yellow
+	runner.StatusUnconfigured: "\x1b[33m", // yellow
+	runner.StatusError:        "\x1b[35m", // magenta
+	runner.StatusUntested:     "\x1b[31m", // red
+}
+
+const colorReset = "\x1b[0m"
+
+// useColor decides whether to colour output written to w based on the -color flag
+func useColor(w io.Writer) (bool, error) {
+	switch *fColor {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if _, set := os.LookupEnv("NO_COLOR"); set {
+			return false, nil
+		}
+		return isTerminal(w), nil
+	default:
+		return false, fmt.Errorf("unknown colour mode %s (expected always, never or auto)", *fColor)
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (t *tableReporter) Report(result runner.RuleResult) error {
+	status := result.Status
+	if result.Status == runner.StatusError {
+		status = result.Error
+	}
+	if t.color {
+		// Every status is coloured so the escape codes add the same width to every cell in the column, keeping it aligned
+		status = statusColors[result.Status] + status + colorReset
+	}
+	if result.Coverage != nil {
+		status += fmt.Sprintf("\t%.0f%% of fields covered", result.Coverage.Percentage())
+	}
+	if result.Benchmark != nil {
+		status += fmt.Sprintf("\t%.0f events/s (%.0f ns/op)", result.Benchmark.EventsPerSecond(), result.Benchmark.NsPerOp())
+	}
+	if result.Fingerprint != "" {
+		status += "\t" + result.Fingerprint
+	}
+	if t.durations {
+		status += fmt.Sprintf("\t%v", result.Duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(t.w, "%s\t%s\t\n", result.Name(), status)
+	if result.Mappings != nil {
+		configs := "none"
+		if len(result.Mappings.Configs) > 0 {
+			configs = strings.Join(result.Mappings.Configs, ", ")
+		}
+		fmt.Fprintf(t.w, "\tconfigs: %s\n", configs)
+		for _, field := range sortedFields(result.Mappings.Fields) {
+			fmt.Fprintf(t.w, "\t    %s -> %s\n", field, strings.Join(result.Mappings.Fields[field], ", "))
+		}
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(t.w, "\twarning: %s\n", warning)
+	}
+	for _, c := range result.Unknown() {
+		fmt.Fprintf(t.w, "\t%s: unknown expectation, %s\n", c.DisplayName(), c.Observed)
+	}
+	for _, failure := range result.Failures() {
+		t.failures++
+		if t.maxFailures > 0 && t.failures > t.maxFailures {
+			t.hiddenFailures++
+			continue
+		}
+		fmt.Fprintf(t.w, "\t%s\n", failure.Reason)
+		for _, search := range sortedKeys(failure.SearchResults) {
+			outcome := "didn't match"
+			if failure.SearchResults[search] {
+				outcome = "matched"
+			}
+			fmt.Fprintf(t.w, "\t    %s: %s\n", search, outcome)
+		}
+		for _, field := range failure.Explanation {
+			outcome := "didn't match"
+			if field.Matched {
+				outcome = "matched"
+			}
+			if field.Error != "" {
+				outcome = "error: " + field.Error
+			}
+			fmt.Fprintf(t.w, "\t    %s.%s (event has %s): %s\n", field.Search, field.Matcher, describeValue(field.Value), outcome)
+		}
+	}
+	return nil
+}
+
+func describeValue(value interface{}) string {
+	if value == nil {
+		return "no value"
+	}
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFields(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *tableReporter) Close() error {
+	if t.hiddenFailures > 0 {
+		fmt.Fprintf(t.w, "... and %d more failures\n", t.hiddenFailures)
+	}
+	return t.w.Flush()
+}
+
+// jsonReporter streams results as a single JSON array (one element per line)
+// so that the output is valid even when results come from multiple root paths
+type jsonReporter struct {
+	w       io.Writer
+	started bool
+}
+
+// jsonResult is how a rule's result is encoded as JSON (only the failing test cases and those with an unknown expectation are included)
+type jsonResult struct {
+	Path     string                `json:"path"`
+	Rule     string                `json:"rule,omitempty"` // identifies the rule within a rule collection
+	Title    string                `json:"title,omitempty"`
+	ID       string                `json:"id,omitempty"`
+	Status   string                `json:"status"`
+	Error    string                `json:"error,omitempty"`
+	Cases    int                   `json:"cases"`
+	Failures []runner.CaseResult   `json:"failures,omitempty"`
+	Unknown  []runner.CaseResult   `json:"unknown,omitempty"`  // test cases with an unknown expectation, with their observed outcome
+	Coverage *runner.FieldCoverage `json:"coverage,omitempty"` // only populated in coverage mode
+	Mappings *runner.Mappings      `json:"mappings,omitempty"` // only populated with -show-mappings
+	Duration float64               `json:"duration_ms"`
+	Warnings []string              `json:"warnings,omitempty"`
+
+	Fingerprint string `json:"fingerprint,omitempty"` // only populated with -fingerprint
+
+	Benchmark *jsonBenchmark `json:"benchmark,omitempty"` // only populated with -benchmark
+}
+
+type jsonBenchmark struct {
+	Evaluations     int     `json:"evaluations"`
+	EventsPerSecond float64 `json:"events_per_second"`
+	NsPerOp         float64 `json:"ns_per_op"`
+}
+
+func (j *jsonReporter) Report(result runner.RuleResult) error {
+	var benchmark *jsonBenchmark
+	if result.Benchmark != nil {
+		benchmark = &jsonBenchmark{
+			Evaluations:     result.Benchmark.Evaluations,
+			EventsPerSecond: result.Benchmark.EventsPerSecond(),
+			NsPerOp:         result.Benchmark.NsPerOp(),
+		}
+	}
+	out, err := json.Marshal(jsonResult{
+		Path:     result.Path,
+		Rule:     result.Rule,
+		Title:    result.Title,
+		ID:       result.ID,
+		Status:   result.Status,
+		Error:    result.Error,
+		Cases:    len(result.Cases),
+		Failures: result.Failures(),
+		Unknown:  result.Unknown(),
+		Coverage: result.Coverage,
+		Mappings: result.Mappings,
+		Duration: float64(result.Duration) / float64(time.Millisecond),
+		Warnings: result.Warnings,
+
+		Fingerprint: result.Fingerprint,
+
+		Benchmark: benchmark,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding result for %s: %w", result.Path, err)
+	}
+
+	separator := ",\n"
+	if !j.started {
+		separator = "[\n"
+		j.started = true
+	}
+	_, err = fmt.Fprintf(j.w, "%s%s", separator, out)
+	return err
+}
+
+func (j *jsonReporter) Close() error {
+	if !j.started {
+		_, err := fmt.Fprintln(j.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(j.w, "\n]")
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"` // in seconds
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// junitReporter collects results into a JUnit XML report where each rule is a
+// <testsuite> and each of its test cases is a <testcase>
+type junitReporter struct {
+	w      io.Writer
+	suites []junitTestSuite
+}
+
+func (j *junitReporter) Report(result runner.RuleResult) error {
+	suite := junitTestSuite{Name: result.Name(), Time: result.Duration.Seconds()}
+
+	switch {
+	case result.Status == runner.StatusSkip:
+		suite.Skipped = 1
+		suite.Cases = []junitTestCase{{Name: result.Name(), ClassName: result.Path, Skipped: &junitMessage{"no test cases"}}}
+	case result.Status == runner.StatusUntested:
+		suite.Failures = 1
+		suite.Cases = []junitTestCase{{Name: result.Name(), ClassName: result.Path, Failure: &junitMessage{"no test cases"}}}
+	case result.Status == runner.StatusUnconfigured:
+		suite.Skipped = 1
+		suite.Cases = []junitTestCase{{Name: result.Name(), ClassName: result.Path, Skipped: &junitMessage{"no config matches the rule's logsource"}}}
+	case result.Status == runner.StatusError && len(result.Cases) == 0:
+		// The rule couldn't be tested at all (rather than individual test cases failing to evaluate)
+		suite.Errors = 1
+		suite.Cases = []junitTestCase{{Name: result.Name(), ClassName: result.Path, Error: &junitMessage{result.Error}}}
+	default:
+		for _, c := range result.Cases {
+			testCase := junitTestCase{Name: c.DisplayName(), ClassName: result.Path}
+			switch {
+			case c.Error != "":
+				suite.Errors++
+				testCase.Error = &junitMessage{c.Reason}
+			case !c.Passed:
+				suite.Failures++
+				testCase.Failure = &junitMessage{c.Reason}
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		// The rule can still error after its test cases were run (e.g. with warnings treated as errors)
+		if result.Status == runner.StatusError {
+			suite.Errors++
+			suite.Cases = append(suite.Cases, junitTestCase{Name: result.Name(), ClassName: result.Path, Error: &junitMessage{result.Error}})
+		}
+	}
+	suite.Tests = len(suite.Cases)
+
+	j.suites = append(j.suites, suite)
+	return nil
+}
+
+func (j *junitReporter) Close() error {
+	if _, err := io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(j.w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: j.suites}); err != nil {
+		return fmt.Errorf("error encoding JUnit report: %w", err)
+	}
+	_, err := fmt.Fprintln(j.w)
+	return err
+}
+
+// tapReporter outputs a Test Anything Protocol stream with a test point for each test case
+type tapReporter struct {
+	w     io.Writer
+	tests int
+	buf   bytes.Buffer // test points are buffered so that the plan can be printed first
+}
+
+func (t *tapReporter) Report(result runner.RuleResult) error {
+	switch {
+	case result.Status == runner.StatusSkip:
+		t.tests++
+		fmt.Fprintf(&t.buf, "ok %d - %s # SKIP no test cases\n", t.tests, result.Name())
+		return nil
+	case result.Status == runner.StatusUntested:
+		t.tests++
+		fmt.Fprintf(&t.buf, "not ok %d - %s\n", t.tests, result.Name())
+		t.diagnostic("no test cases")
+		return nil
+	case result.Status == runner.StatusUnconfigured:
+		t.tests++
+		fmt.Fprintf(&t.buf, "ok %d - %s # SKIP no config matches the rule's logsource\n", t.tests, result.Name())
+		return nil
+	case result.Status == runner.StatusError && len(result.Cases) == 0:
+		t.tests++
+		fmt.Fprintf(&t.buf, "not ok %d - %s\n", t.tests, result.Name())
+		t.diagnostic(result.Error)
+		return nil
+	}
+
+	for _, c := range result.Cases {
+		t.tests++
+		if c.Passed {
+			fmt.Fprintf(&t.buf, "ok %d - %s: %s\n", t.tests, result.Name(), c.DisplayName())
+			if c.Observed != "" {
+				fmt.Fprintf(&t.buf, "# unknown expectation: %s\n", c.Observed)
+			}
+			continue
+		}
+		fmt.Fprintf(&t.buf, "not ok %d - %s: %s\n", t.tests, result.Name(), c.DisplayName())
+		t.diagnostic(c.Reason)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(&t.buf, "# warning: %s: %s\n", result.Name(), warning)
+	}
+	// The rule can still error after its test cases were run (e.g. with warnings treated as errors) so gets a failing test point of its own
+	if result.Status == runner.StatusError {
+		t.tests++
+		fmt.Fprintf(&t.buf, "not ok %d - %s\n", t.tests, result.Name())
+		t.diagnostic(result.Error)
+	}
+	return nil
+}
+
+// diagnostic writes a YAML diagnostic block for the previous test point
+func (t *tapReporter) diagnostic(message string) {
+	fmt.Fprintf(&t.buf, "  ---\n  message: %s\n  ...\n", strconv.Quote(message))
+}
+
+func (t *tapReporter) Close() error {
+	if _, err := fmt.Fprintf(t.w, "TAP version 13\n1..%d\n", t.tests); err != nil {
+		return err
+	}
+	_, err := t.buf.WriteTo(t.w)
+	return err
+}
+
+// githubReporter outputs GitHub Actions workflow commands so that failures are shown as annotations on pull requests
+type githubReporter struct {
+	w io.Writer
+}
+
+func (g *githubReporter) Report(result runner.RuleResult) error {
+	switch {
+	case result.Status == runner.StatusSkip:
+		g.command("notice", result, "no test cases")
+	case result.Status == runner.StatusUntested:
+		g.command("error", result, "no test cases")
+	case result.Status == runner.StatusUnconfigured:
+		g.command("notice", result, "no config matches the rule's logsource")
+	case result.Status == runner.StatusError:
+		// Including rules which errored after their test cases were run (e.g. with warnings treated as errors)
+		g.command("error", result, result.Error)
+	}
+	for _, failure := range result.Failures() {
+		g.command("error", result, failure.DisplayName()+": "+failure.Reason)
+	}
+	for _, c := range result.Unknown() {
+		g.command("notice", result, c.DisplayName()+": unknown expectation, "+c.Observed)
+	}
+	for _, warning := range result.Warnings {
+		g.command("warning", result, warning)
+	}
+	return nil
+}
+
+// command writes a workflow command annotating the rule's file
+func (g *githubReporter) command(level string, result runner.RuleResult, message string) {
+	fmt.Fprintf(g.w, "::%s file=%s,title=%s::%s\n", level, escapeGitHubProperty(result.Path), escapeGitHubProperty(result.Name()), escapeGitHubData(message))
+}
+
+func (g *githubReporter) Close() error {
+	return nil
+}
+
+// escapeGitHubData escapes a workflow command's message
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a workflow command's property value (which additionally can't contain : or ,)
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeGitHubData(s))
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+func TestJSONReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, err := newReporter("json", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &runner.Runner{Recursive: true, OnResult: out.Report}
+	if _, err := r.Run([]string{"testdata/condition-allofthem.yaml", "testdata/no-tests.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []jsonResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, buf.String())
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Status != runner.StatusPass || results[1].Status != runner.StatusSkip {
+		t.Fatalf("unexpected statuses: %s, %s", results[0].Status, results[1].Status)
+	}
+}
+
+func TestJUnitReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, err := newReporter("junit", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &runner.Runner{Recursive: true, OnResult: out.Report}
+	if _, err := r.Run([]string{"testdata/condition-allofthem.yaml", "testdata/no-tests.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report := junitTestSuites{}
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid XML output: %v\n%s", err, buf.String())
+	}
+	if len(report.Suites) != 2 {
+		t.Fatalf("expected 2 test suites, got %d", len(report.Suites))
+	}
+	if report.Suites[0].Tests != 5 || report.Suites[0].Failures != 0 {
+		t.Fatalf("unexpected results for %s: %+v", report.Suites[0].Name, report.Suites[0])
+	}
+	if report.Suites[1].Skipped != 1 || report.Suites[1].Cases[0].Skipped == nil {
+		t.Fatalf("expected %s to be skipped: %+v", report.Suites[1].Name, report.Suites[1])
+	}
+}
+
+func TestGitHubReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, err := newReporter("github", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = out.Report(runner.RuleResult{
+		Path:   "rules/a,b.yaml",
+		Status: runner.StatusFail,
+		Cases:  []runner.CaseResult{{Index: 0, Passed: true}, {Index: 1, Reason: "100% wrong\nreally"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "::error file=rules/a%2Cb.yaml,title=rules/a%2Cb.yaml::case 2: 100%25 wrong%0Areally\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestTAPReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	out, err := newReporter("tap", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []runner.RuleResult{
+		{Path: "pass.yaml", Status: runner.StatusPass, Cases: []runner.CaseResult{{Index: 0, Passed: true}}},
+		{Path: "fail.yaml", Status: runner.StatusFail, Cases: []runner.CaseResult{{Index: 0, Passed: true}, {Index: 1, Name: "benign", Reason: "matched"}}},
+		{Path: "skip.yaml", Status: runner.StatusSkip},
+		{Path: "broken.yaml", Status: runner.StatusError, Error: "invalid condition"},
+		{
+			Path:     "warned.yaml",
+			Status:   runner.StatusError,
+			Error:    "1 warnings treated as errors",
+			Cases:    []runner.CaseResult{{Index: 0, Passed: true}},
+			Warnings: []string{"field Foo isn't mapped"},
+		},
+	}
+	for _, result := range results {
+		if err := out.Report(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `TAP version 13
+1..7
+ok 1 - pass.yaml: case 1
+ok 2 - fail.yaml: case 1
+not ok 3 - fail.yaml: benign
+  ---
+  message: "matched"
+  ...
+ok 4 - skip.yaml # SKIP no test cases
+not ok 5 - broken.yaml
+  ---
+  message: "invalid condition"
+  ...
+ok 6 - warned.yaml: case 1
+# warning: warned.yaml: field Foo isn't mapped
+not ok 7 - warned.yaml
+  ---
+  message: "1 warnings treated as errors"
+  ...
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestErroredRuleWithPassingCases(t *testing.T) {
+	// e.g. a rule whose warnings are treated as errors with -strict
+	result := runner.RuleResult{
+		Path:     "rules/warned.yaml",
+		Status:   runner.StatusError,
+		Error:    "1 warnings treated as errors",
+		Cases:    []runner.CaseResult{{Index: 0, Passed: true}},
+		Warnings: []string{"field Foo isn't mapped"},
+	}
+	render := func(format string) string {
+		buf := &bytes.Buffer{}
+		out, err := newReporter(format, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Report(result); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	report := junitTestSuites{}
+	if err := xml.Unmarshal([]byte(render("junit")), &report); err != nil {
+		t.Fatal(err)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 2 || suite.Errors != 1 || suite.Cases[0].Error != nil || suite.Cases[1].Error == nil || suite.Cases[1].Error.Message != result.Error {
+		t.Errorf("expected the passing case followed by an error for the rule: %+v", suite)
+	}
+
+	expected := "::error file=rules/warned.yaml,title=rules/warned.yaml::1 warnings treated as errors\n" +
+		"::warning file=rules/warned.yaml,title=rules/warned.yaml::field Foo isn't mapped\n"
+	if github := render("github"); github != expected {
+		t.Errorf("expected %q, got %q", expected, github)
+	}
+}
+
+func TestQuietReporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	formatter, err := newReporter("json", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &summaryReporter{reporter: quietReporter{formatter}}
+	r := &runner.Runner{Recursive: true, OnResult: out.Report}
+	if _, err := r.Run([]string{"testdata/condition-allofthem.yaml", "testdata/no-tests.yaml", "testdata/config-test.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []jsonResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, buf.String())
+	}
+	if len(results) != 1 || results[0].Status != runner.StatusFail {
+		t.Fatalf("expected only the failing rule to be output, got %+v", results)
+	}
+	if out.passed != 1 || out.skipped != 1 || out.failed != 1 {
+		t.Fatalf("expected the summary to count every rule, got %s", out)
+	}
+	if out.cases != 9 || out.failedCases != 1 {
+		t.Fatalf("expected the summary to count every test case, got %s", out)
+	}
+}
+
+func TestTableColorAlignment(t *testing.T) {
+	defer func(color string, topSlow int) { *fColor, *fTopSlow = color, topSlow }(*fColor, *fTopSlow)
+	*fColor = "always"
+	*fTopSlow = 1
+
+	buf := &bytes.Buffer{}
+	out, err := newReporter("table", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Report(runner.RuleResult{Path: "a.yaml", Status: runner.StatusPass})
+	out.Report(runner.RuleResult{Path: "b.yaml", Status: runner.StatusError, Error: "something went wrong"})
+	out.Report(runner.RuleResult{Path: "c.yaml", Status: runner.StatusSkip})
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "\x1b[32mPASS\x1b[0m") {
+		t.Fatalf("expected PASS to be coloured green:\n%q", buf.String())
+	}
+	// Once the escape codes are removed, the duration column should line up
+	visible := regexp.MustCompile("\x1b\\[[0-9]+m").ReplaceAllString(buf.String(), "")
+	var offsets []int
+	for _, line := range strings.Split(strings.TrimSpace(visible), "\n") {
+		offsets = append(offsets, strings.Index(line, "0s"))
+	}
+	if offsets[0] != offsets[1] || offsets[1] != offsets[2] {
+		t.Fatalf("columns aren't aligned:\n%s", visible)
+	}
+}
+
+func TestTableDurations(t *testing.T) {
+	defer func(topSlow int) { *fTopSlow = topSlow }(*fTopSlow)
+	result := runner.RuleResult{Path: "a.yaml", Status: runner.StatusPass, Duration: 1500 * time.Microsecond}
+
+	for topSlow, expected := range map[int]string{
+		0: "a.yaml    PASS    \n",
+		3: "a.yaml    PASS    1.5ms    \n",
+	} {
+		*fTopSlow = topSlow
+		buf := &bytes.Buffer{}
+		out, err := newReporter("table", buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Report(result)
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("-top-slow=%d: expected %q but got %q", topSlow, expected, buf.String())
+		}
+	}
+}
+
+func TestTopSlow(t *testing.T) {
+	out := &summaryReporter{reporter: discardReporter{}, topSlow: 2}
+	out.Report(runner.RuleResult{Path: "fast.yaml", Status: runner.StatusPass, Duration: time.Millisecond})
+	out.Report(runner.RuleResult{Path: "slowest.yaml", Status: runner.StatusPass, Duration: 3 * time.Millisecond})
+	out.Report(runner.RuleResult{Path: "slow.yaml", Status: runner.StatusFail, Duration: 2 * time.Millisecond})
+
+	summary := out.String()
+	expected := "\nslowest 2 rules:\n         3ms  slowest.yaml\n         2ms  slow.yaml"
+	if !strings.HasSuffix(summary, expected) {
+		t.Fatalf("expected the two slowest rules to be listed:\n%s", summary)
+	}
+	if strings.Contains(summary, "fast.yaml") {
+		t.Fatalf("expected only the two slowest rules to be listed:\n%s", summary)
+	}
+}
+
+func TestTableMaxFailures(t *testing.T) {
+	defer func(maxFailures int) { *fMaxFailures = maxFailures }(*fMaxFailures)
+	*fMaxFailures = 2
+
+	buf := &bytes.Buffer{}
+	out, err := newReporter("table", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := []runner.CaseResult{{Reason: "first"}, {Reason: "second"}, {Reason: "third"}}
+	out.Report(runner.RuleResult{Path: "a.yaml", Status: runner.StatusFail, Cases: failures})
+	out.Report(runner.RuleResult{Path: "b.yaml", Status: runner.StatusFail, Cases: failures})
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "second") || strings.Contains(output, "third") || !strings.Contains(output, "b.yaml") {
+		t.Fatalf("expected only the first two failures to be printed:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "... and 4 more failures\n") {
+		t.Fatalf("expected the hidden failures to be counted:\n%s", output)
+	}
+}
+
+func TestGroupByDirectory(t *testing.T) {
+	out := &summaryReporter{reporter: discardReporter{}, directories: &directoryNode{}}
+	for _, result := range []runner.RuleResult{
+		{Path: "rules/windows/process_creation/a.yaml", Status: runner.StatusPass},
+		{Path: "rules/windows/process_creation/b.yaml", Status: runner.StatusFail},
+		{Path: "rules/windows/registry/c.yaml", Status: runner.StatusPass},
+		{Path: "rules/linux/d.yaml", Status: runner.StatusSkip},
+		{Path: "rules/e.yaml", Status: runner.StatusPass},
+	} {
+		if err := out.Report(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `results by directory:
+  rules: 3 passed, 1 failed, 1 skipped, 0 errors
+    linux: 0 passed, 0 failed, 1 skipped, 0 errors
+    windows: 2 passed, 1 failed, 0 skipped, 0 errors
+      process_creation: 1 passed, 1 failed, 0 skipped, 0 errors
+      registry: 1 passed, 0 failed, 0 skipped, 0 errors`
+	if summary := out.String(); !strings.HasSuffix(summary, expected) {
+		t.Fatalf("expected the summary to end with:\n%s\ngot:\n%s", expected, summary)
+	}
+}
+
+func TestReportersPreserveFailureOrder(t *testing.T) {
+	result := runner.RuleResult{
+		Path:   "rules/a.yaml",
+		Status: runner.StatusFail,
+		Cases: []runner.CaseResult{
+			{Index: 0, Name: "zulu", Reason: "zulu failed"},
+			{Index: 1, Passed: true},
+			{Index: 2, Name: "yankee", Reason: "yankee failed"},
+			{Index: 3, Name: "xray", Reason: "xray failed"},
+		},
+	}
+	for _, format := range []string{"table", "json", "junit", "tap", "github"} {
+		t.Run(format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			out, err := newReporter(format, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Report(result); err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+			zulu, yankee, xray := strings.Index(buf.String(), "zulu"), strings.Index(buf.String(), "yankee"), strings.Index(buf.String(), "xray")
+			if zulu < 0 || !(zulu < yankee && yankee < xray) {
+				t.Fatalf("expected the failures in test file order, got:\n%s", buf.String())
+			}
+		})
+	}
+}
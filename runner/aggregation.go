@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+)
+
+// hasAggregation checks whether any of the rule's conditions aggregate over several events (e.g. selection | count() > 5)
+func hasAggregation(rule sigma.Rule) bool {
+	for _, condition := range rule.Detection.Conditions {
+		if condition.Aggregation != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregationState implements the evaluator's aggregation functions over the events of a single test case.
+// Every event in a test case is treated as being within the rule's timeframe.
+type aggregationState struct {
+	mu      sync.Mutex
+	counts  map[string]float64
+	sums    map[string]float64
+	samples map[string][]float64 // the values seen by each average
+}
+
+// aggregationOptions returns evaluator options which aggregate over a fresh set of events
+func aggregationOptions() []evaluator.Option {
+	s := &aggregationState{counts: map[string]float64{}, sums: map[string]float64{}, samples: map[string][]float64{}}
+	return []evaluator.Option{
+		evaluator.CountImplementation(s.count),
+		evaluator.SumImplementation(s.sum),
+		evaluator.AverageImplementation(s.average),
+	}
+}
+
+func (s *aggregationState) count(ctx context.Context, key evaluator.GroupedByValues) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key.Key()]++
+	return s.counts[key.Key()], nil
+}
+
+func (s *aggregationState) sum(ctx context.Context, key evaluator.GroupedByValues, value float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sums[key.Key()] += value
+	return s.sums[key.Key()], nil
+}
+
+func (s *aggregationState) average(ctx context.Context, key evaluator.GroupedByValues, value float64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samples := append(s.samples[key.Key()], value)
+	s.samples[key.Key()] = samples
+	total := 0.0
+	for _, sample := range samples {
+		total += sample
+	}
+	return total / float64(len(samples)), nil
+}
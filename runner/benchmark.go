@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+)
+
+// Benchmark records how quickly a rule evaluated its test case events when evaluated repeatedly
+type Benchmark struct {
+	Evaluations int           // the number of events evaluated
+	Duration    time.Duration // the total time spent evaluating them
+}
+
+// EventsPerSecond is the rule's throughput
+func (b Benchmark) EventsPerSecond() float64 {
+	if b.Duration <= 0 {
+		return 0
+	}
+	return float64(b.Evaluations) / b.Duration.Seconds()
+}
+
+// NsPerOp is the average time taken to evaluate a single event
+func (b Benchmark) NsPerOp() float64 {
+	if b.Evaluations == 0 {
+		return 0
+	}
+	return float64(b.Duration.Nanoseconds()) / float64(b.Evaluations)
+}
+
+// benchmarkCase is a test case's events along with the evaluator set up for them
+type benchmarkCase struct {
+	rule   *evaluator.RuleEvaluator
+	events []map[string]interface{}
+}
+
+// benchmark evaluates the events of every test case in turn until r.Benchmark has elapsed.
+// The results were already checked when testing the rule so they're ignored here.
+func (r *Runner) benchmark(cases []benchmarkCase) *Benchmark {
+	if len(cases) == 0 {
+		return nil
+	}
+	b := &Benchmark{}
+	start := time.Now()
+	for time.Since(start) < r.Benchmark {
+		for _, c := range cases {
+			for _, event := range c.events {
+				c.rule.Matches(context.Background(), event)
+				b.Evaluations++
+			}
+		}
+	}
+	b.Duration = time.Since(start)
+	return b
+}
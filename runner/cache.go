@@ -0,0 +1,386 @@
+package runner
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// cacheVersion must be changed whenever the cached types change so that stale caches are discarded
+const cacheVersion = 9
+
+func init() {
+	// Types that can appear inside the interface{} values of decoded YAML
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+
+	// Aggregation expressions are cached as they are (search expressions are converted to cachedExpr)
+	gob.Register(sigma.Comparison{})
+	gob.Register(sigma.Count{})
+	gob.Register(sigma.Min{})
+	gob.Register(sigma.Max{})
+	gob.Register(sigma.Average{})
+	gob.Register(sigma.Sum{})
+}
+
+// Cache stores parsed rule and test files on disk so they don't need to be re-parsed
+// unless they've changed (according to their modification time and size)
+type Cache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	dirty   bool
+}
+
+type cacheEntry struct {
+	ModTime time.Time
+	Size    int64
+
+	// Set for rule files
+	Rules        []cachedRule
+	Correlations []correlationRule
+
+	// Set for test files
+	TestCases    []cachedTestCase
+	Placeholders map[string][]string
+	Config       *sigma.Config
+	// ExpectParseError is set for test files asserting that their rule can't be parsed
+	ExpectParseError bool
+}
+
+// cachedTestCase records the test case's Match separately because gob can't distinguish a pointer to false from nil
+type cachedTestCase struct {
+	TestCase TestCase
+	HasMatch bool
+	Match    bool
+}
+
+type cacheFile struct {
+	Version int
+	Entries map[cacheKey]cacheEntry
+}
+
+// cachedRule is a sigma.Rule with its conditions converted to a form that gob can encode
+type cachedRule struct {
+	Rule       sigma.Rule
+	Conditions []cachedCondition
+}
+
+type cachedCondition struct {
+	Search      cachedExpr
+	Aggregation sigma.AggregationExpr
+}
+
+// cachedExpr is an encodable sigma.SearchExpr (some of which are empty structs which gob refuses to encode)
+type cachedExpr struct {
+	Kind     string
+	Name     string // the identifier or pattern
+	Children []cachedExpr
+}
+
+// LoadCache reads the cache from disk, starting afresh if it doesn't exist or can't be read
+func LoadCache(path string) *Cache {
+	c := &Cache{path: path, entries: map[cacheKey]cacheEntry{}}
+	f, err := os.Open(path)
+	if err != nil {
+		return c
+	}
+	defer f.Close()
+
+	contents := cacheFile{}
+	if err := gob.NewDecoder(f).Decode(&contents); err != nil || contents.Version != cacheVersion {
+		return c
+	}
+	c.entries = contents.Entries
+	return c
+}
+
+// DefaultCachePath is where the cache is stored unless another path is chosen
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sigma-test", "cache.gob"), nil
+}
+
+// Save writes the cache back to disk if anything has changed, dropping the entries for files which no longer exist
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune()
+	if !c.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	// Write to a temporary file first so a concurrent run never sees a partially written cache
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), "cache-*.gob")
+	if err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(cacheFile{Version: cacheVersion, Entries: c.entries}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// prune removes the entries for files which have been deleted (or moved) so that the cache doesn't grow forever
+func (c *Cache) prune() {
+	for key := range c.entries {
+		if _, err := os.Stat(key.Path); errors.Is(err, fs.ErrNotExist) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// Every file is parsed as a rule (even test files) and some as test cases too, so entries are keyed by both
+type cacheKey struct {
+	Path  string
+	Tests bool
+}
+
+func (c *Cache) get(key cacheKey, info os.FileInfo) (cacheEntry, bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !entry.ModTime.Equal(info.ModTime()) || entry.Size != info.Size() {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *Cache) put(key cacheKey, info os.FileInfo, entry cacheEntry) {
+	if c == nil {
+		return
+	}
+	entry.ModTime, entry.Size = info.ModTime(), info.Size()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	c.dirty = true
+}
+
+func keyFor(path string, tests bool) cacheKey {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return cacheKey{Path: path, Tests: tests}
+}
+
+// readRules parses the rules and correlations in a file, using the cache if the file hasn't changed
+func (c *Cache) readRules(path string) ([]sigma.Rule, []correlationRule, error) {
+	// Stat before reading so that a change made while parsing invalidates the cache entry
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if entry, ok := c.get(keyFor(path, false), info); ok {
+		if rules, err := uncacheRules(entry.Rules); err == nil {
+			return rules, entry.Correlations, nil
+		}
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	rules, err := parseRules(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	correlations, err := parseCorrelations(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	if cached, err := cacheRules(rules); err == nil {
+		c.put(keyFor(path, false), info, cacheEntry{Rules: cached, Correlations: correlations})
+	}
+	return rules, correlations, nil
+}
+
+// readTestCases loads the test cases in a file, using the cache if the file hasn't changed
+func (c *Cache) readTestCases(path string) (testSuite, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		// getTestCases handles the file not existing
+		return getTestCases(path)
+	}
+	if entry, ok := c.get(keyFor(path, true), info); ok {
+		suite := testSuite{Placeholders: entry.Placeholders, Config: entry.Config, ExpectParseError: entry.ExpectParseError}
+		for _, c := range entry.TestCases {
+			tc := c.TestCase
+			if c.HasMatch {
+				match := c.Match
+				tc.Match = &match
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		return suite, nil
+	}
+
+	suite, err := getTestCases(path)
+	if err != nil {
+		return testSuite{}, err
+	}
+	cached := make([]cachedTestCase, len(suite.Cases))
+	for i, tc := range suite.Cases {
+		if tc.EventFile != "" {
+			// The event file could change without the test file changing
+			return suite, nil
+		}
+		cached[i] = cachedTestCase{TestCase: tc, HasMatch: tc.Match != nil}
+		if tc.Match != nil {
+			cached[i].Match = *tc.Match
+		}
+	}
+	c.put(keyFor(path, true), info, cacheEntry{TestCases: cached, Placeholders: suite.Placeholders, Config: suite.Config, ExpectParseError: suite.ExpectParseError})
+	return suite, nil
+}
+
+func cacheRules(rules []sigma.Rule) ([]cachedRule, error) {
+	cached := make([]cachedRule, len(rules))
+	for i, rule := range rules {
+		cached[i].Rule = rule
+		cached[i].Rule.Detection.Conditions = nil
+		for _, condition := range rule.Detection.Conditions {
+			if _, ok := condition.Aggregation.(sigma.Near); ok {
+				return nil, fmt.Errorf("near aggregations can't be cached")
+			}
+			search, err := cacheExpr(condition.Search)
+			if err != nil {
+				return nil, err
+			}
+			cached[i].Conditions = append(cached[i].Conditions, cachedCondition{Search: search, Aggregation: condition.Aggregation})
+		}
+	}
+	return cached, nil
+}
+
+func uncacheRules(cached []cachedRule) ([]sigma.Rule, error) {
+	rules := make([]sigma.Rule, len(cached))
+	for i, c := range cached {
+		rules[i] = c.Rule
+		for _, condition := range c.Conditions {
+			search, err := uncacheExpr(condition.Search)
+			if err != nil {
+				return nil, err
+			}
+			rules[i].Detection.Conditions = append(rules[i].Detection.Conditions, sigma.Condition{Search: search, Aggregation: condition.Aggregation})
+		}
+	}
+	return rules, nil
+}
+
+func cacheExpr(expr sigma.SearchExpr) (cachedExpr, error) {
+	switch e := expr.(type) {
+	case sigma.And:
+		return cacheExprs("and", e)
+	case sigma.Or:
+		return cacheExprs("or", e)
+	case sigma.Not:
+		c, err := cacheExpr(e.Expr)
+		if err != nil {
+			return cachedExpr{}, err
+		}
+		return cachedExpr{Kind: "not", Children: []cachedExpr{c}}, nil
+	case sigma.SearchIdentifier:
+		return cachedExpr{Kind: "identifier", Name: e.Name}, nil
+	case sigma.OneOfIdentifier:
+		return cachedExpr{Kind: "one of identifier", Name: e.Ident.Name}, nil
+	case sigma.AllOfIdentifier:
+		return cachedExpr{Kind: "all of identifier", Name: e.Ident.Name}, nil
+	case sigma.OneOfPattern:
+		return cachedExpr{Kind: "one of pattern", Name: e.Pattern}, nil
+	case sigma.AllOfPattern:
+		return cachedExpr{Kind: "all of pattern", Name: e.Pattern}, nil
+	case sigma.OneOfThem:
+		return cachedExpr{Kind: "one of them"}, nil
+	case sigma.AllOfThem:
+		return cachedExpr{Kind: "all of them"}, nil
+	case nil:
+		return cachedExpr{}, nil
+	default:
+		return cachedExpr{}, fmt.Errorf("can't cache search expression %T", expr)
+	}
+}
+
+func cacheExprs(kind string, exprs []sigma.SearchExpr) (cachedExpr, error) {
+	cached := cachedExpr{Kind: kind}
+	for _, expr := range exprs {
+		c, err := cacheExpr(expr)
+		if err != nil {
+			return cachedExpr{}, err
+		}
+		cached.Children = append(cached.Children, c)
+	}
+	return cached, nil
+}
+
+func uncacheExpr(c cachedExpr) (sigma.SearchExpr, error) {
+	var children []sigma.SearchExpr
+	for _, child := range c.Children {
+		expr, err := uncacheExpr(child)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, expr)
+	}
+
+	switch c.Kind {
+	case "and":
+		return sigma.And(children), nil
+	case "or":
+		return sigma.Or(children), nil
+	case "not":
+		if len(children) != 1 {
+			return nil, fmt.Errorf("invalid cached not expression")
+		}
+		return sigma.Not{Expr: children[0]}, nil
+	case "identifier":
+		return sigma.SearchIdentifier{Name: c.Name}, nil
+	case "one of identifier":
+		return sigma.OneOfIdentifier{Ident: sigma.SearchIdentifier{Name: c.Name}}, nil
+	case "all of identifier":
+		return sigma.AllOfIdentifier{Ident: sigma.SearchIdentifier{Name: c.Name}}, nil
+	case "one of pattern":
+		return sigma.OneOfPattern{Pattern: c.Name}, nil
+	case "all of pattern":
+		return sigma.AllOfPattern{Pattern: c.Name}, nil
+	case "one of them":
+		return sigma.OneOfThem{}, nil
+	case "all of them":
+		return sigma.AllOfThem{}, nil
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid cached search expression %s", c.Kind)
+	}
+}
@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.gob")
+	cache := LoadCache(cachePath)
+
+	paths, err := filepath.Glob("../testdata/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules are compared by their formatting as gob doesn't distinguish between nil and empty slices
+	type parsed struct {
+		rules string
+		tests interface{}
+	}
+	parse := func() map[string]parsed {
+		results := map[string]parsed{}
+		for _, path := range paths {
+			if strings.HasSuffix(path, "_test.yaml") {
+				suite, err := cache.readTestCases(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				results[path] = parsed{tests: suite}
+				continue
+			}
+			rules, correlations, err := cache.readRules(path)
+			if err != nil {
+				continue // not every file in testdata is a rule
+			}
+			results[path] = parsed{rules: fmt.Sprint(rules, correlations)}
+		}
+		return results
+	}
+
+	uncached := parse()
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatalf("cache wasn't saved: %v", err)
+	}
+
+	cache = LoadCache(cachePath)
+	if len(cache.entries) == 0 {
+		t.Fatal("cache wasn't loaded")
+	}
+	cached := parse()
+	if cache.dirty {
+		t.Error("expected every file to be loaded from the cache")
+	}
+	for path := range uncached {
+		if !reflect.DeepEqual(uncached[path], cached[path]) {
+			t.Errorf("%s: cached result differs:\n%#v\n%#v", path, uncached[path], cached[path])
+		}
+	}
+}
+
+func TestCachePrunesDeletedFiles(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "cache.gob")
+	cache := LoadCache(cachePath)
+
+	dir := t.TempDir()
+	kept, deleted := filepath.Join(dir, "kept.yaml"), filepath.Join(dir, "deleted.yaml")
+	for _, path := range []string{kept, deleted} {
+		if err := os.WriteFile(path, []byte("detection:\n  selection:\n    a: foo\n  condition: selection\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := cache.readRules(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing else has changed but the deleted file's entry is still removed
+	if err := os.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCache(cachePath).Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache = LoadCache(cachePath)
+	if _, ok := cache.entries[keyFor(deleted, false)]; ok {
+		t.Error("expected the deleted file's entry to be pruned")
+	}
+	if _, ok := cache.entries[keyFor(kept, false)]; !ok {
+		t.Error("expected the existing file's entry to be kept")
+	}
+}
+
+// BenchmarkRun runs a generated tree of rules (each with two test cases) with and without a warm cache
+func BenchmarkRun(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 1000; i++ {
+		rule := fmt.Sprintf("title: Rule %d\ndetection:\n  selection:\n    CommandLine|contains: foo%d\n    User: admin\n  condition: selection\n", i, i)
+		tests := fmt.Sprintf("event:\n  CommandLine: run foo%d now\n  User: admin\n---\nmatch: false\nevent:\n  CommandLine: run bar now\n  User: admin\n", i)
+		path := filepath.Join(dir, fmt.Sprintf("rule%d.yaml", i))
+		if err := os.WriteFile(path, []byte(rule), 0644); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("rule%d_test.yaml", i)), []byte(tests), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	run := func(b *testing.B, r *Runner) {
+		report, err := r.Run([]string{dir})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !report.Passed {
+			b.Fatal("expected every rule to pass")
+		}
+	}
+
+	b.Run("no cache", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			run(b, &Runner{})
+		}
+	})
+	b.Run("cache", func(b *testing.B) {
+		cachePath := filepath.Join(b.TempDir(), "cache.gob")
+		cache := LoadCache(cachePath)
+		run(b, &Runner{Cache: cache}) // warm the cache
+		if err := cache.Save(); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		// The cache is loaded from disk each time as it would be by separate runs
+		for i := 0; i < b.N; i++ {
+			run(b, &Runner{Cache: LoadCache(cachePath)})
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// When CaseInsensitiveFields is set, the field names in the rule, the configs and the events are all lowercased before evaluation
+// so that e.g. a rule using CommandLine matches an event with commandline.
+
+// lowercaseFields returns a copy of the rule with the fields in its detection (including those used by aggregations) lowercased
+func lowercaseFields(rule sigma.Rule) sigma.Rule {
+	searches := make(map[string]sigma.Search, len(rule.Detection.Searches))
+	for name, search := range rule.Detection.Searches {
+		searches[name] = lowercaseSearch(search)
+	}
+	rule.Detection.Searches = searches
+
+	conditions := make(sigma.Conditions, len(rule.Detection.Conditions))
+	for i, condition := range rule.Detection.Conditions {
+		if comparison, ok := condition.Aggregation.(sigma.Comparison); ok {
+			comparison.Func = lowercaseAggregation(comparison.Func)
+			condition.Aggregation = comparison
+		}
+		conditions[i] = condition
+	}
+	rule.Detection.Conditions = conditions
+	return rule
+}
+
+func lowercaseSearch(search sigma.Search) sigma.Search {
+	matchers := make([]sigma.EventMatcher, len(search.EventMatchers))
+	for i, matcher := range search.EventMatchers {
+		matchers[i] = make(sigma.EventMatcher, len(matcher))
+		for j, field := range matcher {
+			field.Field = strings.ToLower(field.Field)
+			matchers[i][j] = field
+		}
+	}
+	search.EventMatchers = matchers
+	return search
+}
+
+func lowercaseAggregation(function sigma.AggregationFunc) sigma.AggregationFunc {
+	switch f := function.(type) {
+	case sigma.Count:
+		return sigma.Count{Field: strings.ToLower(f.Field), GroupedBy: strings.ToLower(f.GroupedBy)}
+	case sigma.Min:
+		return sigma.Min{Field: strings.ToLower(f.Field), GroupedBy: strings.ToLower(f.GroupedBy)}
+	case sigma.Max:
+		return sigma.Max{Field: strings.ToLower(f.Field), GroupedBy: strings.ToLower(f.GroupedBy)}
+	case sigma.Average:
+		return sigma.Average{Field: strings.ToLower(f.Field), GroupedBy: strings.ToLower(f.GroupedBy)}
+	case sigma.Sum:
+		return sigma.Sum{Field: strings.ToLower(f.Field), GroupedBy: strings.ToLower(f.GroupedBy)}
+	default:
+		return function
+	}
+}
+
+// lowercaseConfigs returns copies of the configs with the fields in their field mappings and logsource conditions lowercased
+func lowercaseConfigs(configs []sigma.Config) []sigma.Config {
+	lowercased := make([]sigma.Config, len(configs))
+	for i, config := range configs {
+		mappings := make(map[string]sigma.FieldMapping, len(config.FieldMappings))
+		for field, mapping := range config.FieldMappings {
+			targets := make([]string, len(mapping.TargetNames))
+			for j, target := range mapping.TargetNames {
+				targets[j] = strings.ToLower(target)
+			}
+			mappings[strings.ToLower(field)] = sigma.FieldMapping{TargetNames: targets}
+		}
+		config.FieldMappings = mappings
+
+		logsources := make(map[string]sigma.LogsourceMapping, len(config.Logsources))
+		for name, logsource := range config.Logsources {
+			logsource.Conditions = lowercaseSearch(logsource.Conditions)
+			logsources[name] = logsource
+		}
+		config.Logsources = logsources
+		lowercased[i] = config
+	}
+	return lowercased
+}
+
+// lowercaseKeys returns copies of the events with their keys (including those of nested maps) lowercased
+func lowercaseKeys(events []map[string]interface{}) []map[string]interface{} {
+	lowercased := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		lowercased[i] = lowercaseMap(event)
+	}
+	return lowercased
+}
+
+func lowercaseMap(event map[string]interface{}) map[string]interface{} {
+	if event == nil {
+		return nil
+	}
+	lowercased := make(map[string]interface{}, len(event))
+	for key, value := range event {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = lowercaseMap(nested)
+		}
+		lowercased[strings.ToLower(key)] = value
+	}
+	return lowercased
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"gopkg.in/yaml.v3"
+)
+
+// parseRules parses the rules from a rule file.
+// As well as a single rule, this supports rule collections: multiple YAML documents where
+// an "action: global" document contains fields shared by all the following rules (until an "action: reset")
+// and an "action: repeat" document is a variant of the previous rule with its fields overridden.
+// If the file doesn't contain any rules then no rules (and no error) are returned.
+func parseRules(contents []byte) ([]sigma.Rule, error) {
+	documents := decodeDocuments(contents)
+	if len(documents) <= 1 {
+		if sigma.InferFileType(contents) != sigma.RuleFile {
+			return nil, nil
+		}
+		rule, err := sigma.ParseRule(contents)
+		if err != nil {
+			return nil, err
+		}
+		return []sigma.Rule{rule}, nil
+	}
+
+	var rules []sigma.Rule
+	global := map[string]interface{}{}
+	var previous map[string]interface{} // the previous rule (without the global fields) so that it can be repeated
+	for i, document := range documents {
+		action := document["action"]
+		delete(document, "action")
+
+		switch action {
+		case "global":
+			global = document
+			continue
+		case "reset":
+			global = map[string]interface{}{}
+			continue
+		case "repeat":
+			if previous == nil {
+				return nil, fmt.Errorf("document %d: action repeat without a previous rule to repeat", i+1)
+			}
+			document = mergeDocuments(previous, document)
+		case nil:
+		default:
+			return nil, fmt.Errorf("document %d: unsupported action %v", i+1, action)
+		}
+
+		previous = document
+		merged, err := yaml.Marshal(mergeDocuments(global, document))
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		if sigma.InferFileType(merged) != sigma.RuleFile {
+			continue
+		}
+		rule, err := sigma.ParseRule(merged)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// decodeDocuments decodes each of the YAML documents in a file, returning nil if the file isn't a valid stream of YAML mappings
+func decodeDocuments(contents []byte) []map[string]interface{} {
+	var documents []map[string]interface{}
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var document map[string]interface{}
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return documents
+		}
+		if err != nil {
+			return nil
+		}
+		// Empty documents (e.g. from a trailing "---") can be ignored
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+}
+
+// mergeDocuments recursively merges two YAML documents with values from override taking precedence over those in base
+func mergeDocuments(base, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeDocuments(baseMap, overrideMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
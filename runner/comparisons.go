@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// comparisons are the numeric comparison modifiers, which the evaluator doesn't support.
+// A field using one is rewritten to comparisonField (with the value true) and markComparisons adds whether the event's value satisfies the comparison to each event.
+var comparisons = map[string]func(actual, expected float64) bool{
+	"gt":  func(actual, expected float64) bool { return actual > expected },
+	"gte": func(actual, expected float64) bool { return actual >= expected },
+	"lt":  func(actual, expected float64) bool { return actual < expected },
+	"lte": func(actual, expected float64) bool { return actual <= expected },
+}
+
+// comparison returns the numeric comparison modifier used by a field matcher along with the values the event's value is compared to.
+// With the all modifier, only the strictest value needs to be compared to (e.g. the largest for gt) as it implies the others.
+func comparison(field sigma.FieldMatcher) (string, []string, bool) {
+	for _, modifier := range field.Modifiers {
+		if _, ok := comparisons[modifier]; !ok {
+			continue
+		}
+		if !hasModifier(field, "all") || len(field.Values) < 2 {
+			return modifier, field.Values, true
+		}
+		strictest := field.Values[0]
+		for _, value := range field.Values[1:] {
+			// Values which aren't numbers are reported by checkComparisons
+			current, _ := parseNumber(strictest)
+			next, _ := parseNumber(value)
+			if comparisons[modifier](next, current) {
+				strictest = value
+			}
+		}
+		return modifier, []string{strictest}, true
+	}
+	return "", nil, false
+}
+
+// comparisonField is the name a field compared by a numeric modifier is rewritten to.
+// The values are part of the name as different searches can compare the same field to different values.
+func comparisonField(field, modifier string, values []string) string {
+	return modifier + "(" + field + ", " + strings.Join(values, ", ") + ")"
+}
+
+// checkComparisons reports values compared by numeric modifiers which aren't numbers as they could never match
+func checkComparisons(rule sigma.Rule) error {
+	for _, name := range sortedSearches(rule) {
+		for _, matcher := range rule.Detection.Searches[name].EventMatchers {
+			for _, field := range matcher {
+				modifier, _, ok := comparison(field)
+				if !ok {
+					continue
+				}
+				for _, value := range field.Values {
+					if _, ok := parseNumber(value); !ok {
+						return fmt.Errorf("invalid number %q for %s|%s in %s", value, field.Field, modifier, name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// markComparisons adds whether each event satisfies the rule's numeric comparisons to copies of the events
+func markComparisons(rule sigma.Rule, configs []sigma.Config, events []map[string]interface{}) []map[string]interface{} {
+	var compared []sigma.FieldMatcher
+	for _, search := range rule.Detection.Searches {
+		for _, matcher := range search.EventMatchers {
+			for _, field := range matcher {
+				if _, _, ok := comparison(field); ok {
+					compared = append(compared, field)
+				}
+			}
+		}
+	}
+	if len(compared) == 0 {
+		return events
+	}
+
+	marked := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		marked[i] = make(map[string]interface{}, len(event)+len(compared))
+		for key, value := range event {
+			marked[i][key] = value
+		}
+		for _, field := range compared {
+			modifier, values, _ := comparison(field)
+			marked[i][comparisonField(field.Field, modifier, values)] = compares(modifier, values, fieldValues(field.Field, configs, event))
+		}
+	}
+	return marked
+}
+
+// compares checks whether any of the event's values for a field satisfies the comparison with any of the rule's values.
+// Event values are compared as numbers whether they're numbers or strings containing one (e.g. from a quoted YAML value).
+func compares(modifier string, values []string, actual []interface{}) bool {
+	for _, a := range actual {
+		number, ok := parseNumber(fmt.Sprint(a))
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if expected, ok := parseNumber(value); ok && comparisons[modifier](number, expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldValues returns an event's values for a field using the names it's looked up by after applying the configs (with list values being flattened)
+func fieldValues(field string, configs []sigma.Config, event map[string]interface{}) []interface{} {
+	var values []interface{}
+	for _, name := range mappedNames(field, configs) {
+		var value interface{}
+		var ok bool
+		if strings.HasPrefix(name, "$.") {
+			value, ok = lookupPath(strings.TrimPrefix(name, "$."), event)
+		} else {
+			value, ok = event[name]
+		}
+		if !ok {
+			continue
+		}
+		if list, isList := value.([]interface{}); isList {
+			values = append(values, list...)
+		} else {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseNumber parses base 10 integers and decimals, ignoring surrounding whitespace.
+// Zero-padded values (e.g. "0123") are decimal rather than octal, and base prefixes, digit separators and non-finite values (e.g. "NaN" or "Inf") aren't numbers.
+func parseNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if integer, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return float64(integer), true
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// checkConditions reports conditions referring to searches which aren't defined in the rule's detection (e.g. a typo like "filetr").
+// The evaluator treats an undefined search as never matching so these otherwise show up as confusing test failures.
+func checkConditions(rule sigma.Rule) error {
+	undefined := map[string]bool{}
+	for _, condition := range rule.Detection.Conditions {
+		undefinedIdentifiers(condition.Search, rule.Detection.Searches, undefined)
+	}
+	if len(undefined) == 0 {
+		return nil
+	}
+	names := sortedKeys(undefined)
+	if len(names) == 1 {
+		return fmt.Errorf("condition refers to undefined search %s", names[0])
+	}
+	return fmt.Errorf("condition refers to undefined searches %s", strings.Join(names, ", "))
+}
+
+// undefinedIdentifiers adds the identifiers (and patterns) in expr which don't refer to any of the searches to undefined
+func undefinedIdentifiers(expr sigma.SearchExpr, searches map[string]sigma.Search, undefined map[string]bool) {
+	switch e := expr.(type) {
+	case sigma.And:
+		for _, child := range e {
+			undefinedIdentifiers(child, searches, undefined)
+		}
+	case sigma.Or:
+		for _, child := range e {
+			undefinedIdentifiers(child, searches, undefined)
+		}
+	case sigma.Not:
+		undefinedIdentifiers(e.Expr, searches, undefined)
+	case sigma.SearchIdentifier:
+		if _, ok := searches[e.Name]; !ok {
+			undefined[e.Name] = true
+		}
+	case sigma.OneOfIdentifier:
+		undefinedIdentifiers(e.Ident, searches, undefined)
+	case sigma.AllOfIdentifier:
+		undefinedIdentifiers(e.Ident, searches, undefined)
+	case sigma.OneOfPattern:
+		undefinedPattern(e.Pattern, searches, undefined)
+	case sigma.AllOfPattern:
+		undefinedPattern(e.Pattern, searches, undefined)
+	}
+}
+
+// undefinedPattern adds the pattern to undefined if it doesn't match any of the searches (matching the evaluator's use of path.Match)
+func undefinedPattern(pattern string, searches map[string]sigma.Search, undefined map[string]bool) {
+	for name := range searches {
+		if matched, _ := path.Match(pattern, name); matched {
+			return
+		}
+	}
+	undefined[pattern] = true
+}
+
+// conditionMatches evaluates a condition's search expression using the result of each search (in the same way as the evaluator)
+func conditionMatches(expr sigma.SearchExpr, searches map[string]sigma.Search, results map[string]bool) bool {
+	switch e := expr.(type) {
+	case sigma.And:
+		for _, child := range e {
+			if !conditionMatches(child, searches, results) {
+				return false
+			}
+		}
+		return true
+	case sigma.Or:
+		for _, child := range e {
+			if conditionMatches(child, searches, results) {
+				return true
+			}
+		}
+		return false
+	case sigma.Not:
+		return !conditionMatches(e.Expr, searches, results)
+	case sigma.SearchIdentifier:
+		return results[e.Name]
+	case sigma.OneOfIdentifier:
+		return results[e.Ident.Name]
+	case sigma.AllOfIdentifier:
+		return results[e.Ident.Name]
+	case sigma.OneOfThem:
+		return searchesMatch(searches, results, "", false)
+	case sigma.AllOfThem:
+		return searchesMatch(searches, results, "", true)
+	case sigma.OneOfPattern:
+		return searchesMatch(searches, results, e.Pattern, false)
+	case sigma.AllOfPattern:
+		return searchesMatch(searches, results, e.Pattern, true)
+	default:
+		return false
+	}
+}
+
+// searchesMatch checks whether any (or all) of the searches with names matching the pattern matched (an empty pattern matches every search)
+func searchesMatch(searches map[string]sigma.Search, results map[string]bool, pattern string, all bool) bool {
+	for name := range searches {
+		if matched, _ := path.Match(pattern, name); pattern != "" && !matched {
+			continue
+		}
+		if results[name] != all {
+			return !all
+		}
+	}
+	return all
+}
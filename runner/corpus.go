@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+	"gopkg.in/yaml.v3"
+)
+
+// CorpusReport records which rules matched which of the samples in a corpus of captured events
+type CorpusReport struct {
+	Samples int // the number of events in the corpus
+	Results []CorpusResult
+}
+
+// CorpusResult records which samples a single rule matched
+type CorpusResult struct {
+	Path    string
+	Rule    string // identifies the rule within a rule collection
+	Title   string
+	ID      string
+	Matches []string // the names of the samples the rule matched (their path in the corpus, with their position if the file contains several events)
+	Error   string   // set if the rule couldn't be evaluated
+}
+
+// Name identifies the rule for display, distinguishing between the rules in a collection
+func (c CorpusResult) Name() string {
+	return RuleResult{Path: c.Path, Rule: c.Rule}.Name()
+}
+
+// sample is an event loaded from a corpus
+type sample struct {
+	name  string
+	event map[string]interface{}
+}
+
+// RunCorpus evaluates every rule found in the given paths against every event in the corpus directory, ignoring the rules' test files.
+// Events are loaded from JSON files (containing an object, an array of objects or one object per line) and YAML files (containing an object).
+// Correlation rules and rules using aggregations are skipped as their outcome depends on the order of the events.
+func (r *Runner) RunCorpus(paths []string, corpus string) (CorpusReport, error) {
+	r.listings = newDirListings()
+	r.Filter.prepare()
+	samples, err := loadCorpus(corpus)
+	if err != nil {
+		return CorpusReport{}, err
+	}
+	events := make([]map[string]interface{}, len(samples))
+	for i, s := range samples {
+		events[i] = s.event
+	}
+	events = r.preprocess(events)
+	if r.CaseInsensitiveFields {
+		events = lowercaseKeys(events)
+	}
+
+	report := CorpusReport{Samples: len(samples)}
+	for _, root := range paths {
+		found, err := r.findRules(root)
+		if err != nil {
+			return report, err
+		}
+		for _, path := range found {
+			rules, _, err := r.Cache.readRules(path)
+			if err != nil {
+				report.Results = append(report.Results, CorpusResult{Path: path, Error: err.Error()})
+				continue
+			}
+			for i, rule := range rules {
+				if !r.Filter.Selected(rule) {
+					continue
+				}
+				if hasAggregation(rule) {
+					r.log().Debug("skipping rule", "path", path, "title", rule.Title, "reason", "uses an aggregation")
+					continue
+				}
+				result := CorpusResult{Path: path, Title: rule.Title, ID: rule.ID}
+				if len(rules) > 1 {
+					result.Rule = rule.ID
+					if result.Rule == "" {
+						result.Rule = fmt.Sprintf("#%d", i+1)
+					}
+				}
+				matches, err := r.matchCorpus(rule, samples, events)
+				if err != nil {
+					result.Error = err.Error()
+				}
+				result.Matches = matches
+				report.Results = append(report.Results, result)
+			}
+		}
+	}
+	return report, nil
+}
+
+// matchCorpus returns the names of the samples which the rule matches
+func (r *Runner) matchCorpus(rule sigma.Rule, samples []sample, events []map[string]interface{}) ([]string, error) {
+	if err := checkConditions(rule); err != nil {
+		return nil, err
+	}
+	if err := checkRegexes(rule); err != nil {
+		return nil, err
+	}
+	if err := checkComparisons(rule); err != nil {
+		return nil, err
+	}
+	relevant, configured := r.configsFor(rule)
+	if !configured {
+		return nil, errNoLogSources
+	}
+	if r.CaseInsensitiveFields {
+		rule, relevant = lowercaseFields(rule), lowercaseConfigs(relevant)
+	}
+
+	expander := evaluator.WithPlaceholderExpander(placeholderExpander(r.Placeholders, nil))
+	ruleEvaluator := evaluator.ForRule(expandModifiers(rule), evaluator.WithConfig(relevant...), expander)
+	var matches []string
+	for i, event := range prepareEvents(rule, relevant, events) {
+		result, err := r.matches(ruleEvaluator, event)
+		if err != nil {
+			return matches, fmt.Errorf("error evaluating %s: %w", samples[i].name, err)
+		}
+		if result.Match {
+			matches = append(matches, samples[i].name)
+		}
+	}
+	return matches, nil
+}
+
+// loadCorpus loads the events in every JSON and YAML file in the directory (and its subdirectories) in order of their paths
+func loadCorpus(dir string) ([]sample, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".jsonl", ".ndjson", ".yaml", ".yml":
+			if !entry.IsDir() {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading corpus: %w", err)
+	}
+	sort.Strings(files)
+
+	var samples []sample
+	for _, path := range files {
+		events, err := loadSamples(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading corpus sample %s: %w", path, err)
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+		for i, event := range events {
+			s := sample{name: name, event: event}
+			if len(events) > 1 {
+				s.name = fmt.Sprintf("%s#%d", name, i+1)
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples, nil
+}
+
+// loadSamples loads the events in a corpus file
+func loadSamples(path string) ([]map[string]interface{}, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		var event map[string]interface{}
+		if err := yaml.Unmarshal(contents, &event); err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{event}, nil
+	}
+
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			events = append(events, v)
+		case []interface{}:
+			for i, element := range v {
+				event, ok := element.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("element %d isn't a JSON object", i+1)
+				}
+				events = append(events, event)
+			}
+		default:
+			return nil, fmt.Errorf("expected JSON objects but got %T", value)
+		}
+	}
+}
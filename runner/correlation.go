@@ -0,0 +1,298 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+	"gopkg.in/yaml.v3"
+)
+
+// correlationRule is a Sigma correlation rule which aggregates the matches of other rules over a sequence of events.
+// sigma-go doesn't support these yet so they're parsed and evaluated here.
+type correlationRule struct {
+	Title       string
+	ID          string
+	Name        string
+	Tags        []string
+	Correlation struct {
+		Type      string
+		Rules     []string           // the names or IDs of the rules being correlated
+		GroupBy   []string           `yaml:"group-by"`
+		Timespan  string             // not used: all the events in a test case are treated as being within the timespan
+		Field     string             // the field whose distinct values are counted (for value_count correlations)
+		Condition map[string]float64 // comparisons (gt, gte, lt, lte, eq, neq) that the aggregated value must satisfy
+	}
+}
+
+// parseCorrelations parses any correlation rules from a rule file
+func parseCorrelations(contents []byte) ([]correlationRule, error) {
+	var correlations []correlationRule
+	for i, document := range decodeDocuments(contents) {
+		if _, ok := document["correlation"]; !ok {
+			continue
+		}
+		encoded, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		correlation := correlationRule{}
+		if err := yaml.Unmarshal(encoded, &correlation); err != nil {
+			return nil, fmt.Errorf("document %d: invalid correlation: %w", i+1, err)
+		}
+		correlations = append(correlations, correlation)
+	}
+	return correlations, nil
+}
+
+// testCorrelation runs the test cases for a correlation rule.
+// Each test case supplies a sequence of events which are fed through the correlated rules in order,
+// with the test case asserting whether the correlation has fired by the end of the sequence.
+func (r *Runner) testCorrelation(path string, testsPaths []string, c correlationRule, rules []sigma.Rule, result *RuleResult) error {
+	suite, err := r.readTests(testsPaths)
+	if err != nil {
+		return err
+	}
+	testCases := suite.Cases
+	if len(testCases) == 0 {
+		return errNoTests
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	for i, tc := range testCases {
+		// These assert things about evaluating a single rule so would otherwise be silently ignored
+		switch {
+		case tc.ExpectError:
+			return fmt.Errorf("test case %d: expect_error isn't supported for correlation rules", i+1)
+		case tc.MatchedSelections != nil:
+			return fmt.Errorf("test case %d: matched_selections isn't supported for correlation rules", i+1)
+		case tc.SuppressedBy != "":
+			return fmt.Errorf("test case %d: suppressed_by isn't supported for correlation rules", i+1)
+		}
+	}
+	placeholders := mergePlaceholders(r.Placeholders, suite.Placeholders)
+
+	correlated := map[string]correlatedRule{}
+	for _, reference := range c.Correlation.Rules {
+		rule, ok := findRule(reference, rules)
+		if !ok {
+			return fmt.Errorf("correlation references rule %s which isn't in %s", reference, path)
+		}
+		if err := checkConditions(rule); err != nil {
+			return fmt.Errorf("rule %s: %w", reference, err)
+		}
+		if err := checkRegexes(rule); err != nil {
+			return fmt.Errorf("rule %s: %w", reference, err)
+		}
+		if err := checkComparisons(rule); err != nil {
+			return fmt.Errorf("rule %s: %w", reference, err)
+		}
+		configs, configured := r.configsFor(rule)
+		if !configured {
+			return errNoLogSources
+		}
+		if suite.Config != nil {
+			configs = append(configs, *suite.Config)
+		}
+		result.configs = append(result.configs, configs...)
+		correlated[reference] = correlatedRule{
+			rule:      rule,
+			configs:   configs,
+			evaluator: evaluator.ForRule(expandModifiers(rule), evaluator.WithConfig(configs...), evaluator.WithPlaceholderExpander(placeholderExpander(placeholders, nil))),
+		}
+	}
+
+	pass, evaluated := true, true
+	defer func(start time.Time) { result.Duration = time.Since(start) }(time.Now())
+	for i, tc := range testCases {
+		caseResult := CaseResult{Index: i, Name: tc.Name, Event: tc.Event, Message: tc.Message, Passed: true}
+		shouldMatch := true
+		if tc.Match != nil { // by default, test cases match
+			shouldMatch = *tc.Match
+		}
+
+		events := r.preprocess(tc.events())
+		fired, err := c.evaluate(r, correlated, events)
+		switch {
+		case err != nil:
+			evaluated = false
+			caseResult.Reason = fmt.Sprintf("error evaluating %s: %v", tc.describe(), err)
+			caseResult.Error = err.Error()
+		case tc.Expect == expectUnknown:
+			caseResult.Observed = "didn't fire"
+			if fired {
+				caseResult.Observed = "fired"
+			}
+		case shouldMatch && !fired:
+			caseResult.Reason = fmt.Sprintf("%s should have fired the correlation%s", tc.describe(), tc.explainedReason())
+		case !shouldMatch && fired:
+			caseResult.Reason = fmt.Sprintf("%s shouldn't have fired the correlation%s", tc.describe(), tc.explainedReason())
+		}
+		if caseResult.Reason != "" {
+			pass = false
+			caseResult.Passed = false
+		}
+		result.Cases = append(result.Cases, caseResult)
+	}
+
+	switch {
+	case !evaluated:
+		return errEvaluationFailed
+	case !pass:
+		return errFailedTests
+	default:
+		return nil
+	}
+}
+
+// findRule finds a rule by its ID or name
+func findRule(reference string, rules []sigma.Rule) (sigma.Rule, bool) {
+	for _, rule := range rules {
+		if rule.ID == reference || rule.AdditionalFields["name"] == reference {
+			return rule, true
+		}
+	}
+	return sigma.Rule{}, false
+}
+
+// correlatedRule is a rule referenced by a correlation along with the configs it's evaluated with
+type correlatedRule struct {
+	rule      sigma.Rule
+	configs   []sigma.Config
+	evaluator *evaluator.RuleEvaluator
+}
+
+// evaluate feeds the events through the correlated rules, returning whether the correlation fired for any group
+func (c correlationRule) evaluate(r *Runner, rules map[string]correlatedRule, events []map[string]interface{}) (bool, error) {
+	counts := map[string]int{}
+	values := map[string]map[string]bool{}
+	seen := map[string]map[string]bool{}
+
+	for _, event := range events {
+		// Fields are looked up using the configs of the first correlated rule which matched the event
+		var matched []string
+		var configs []sigma.Config
+		for _, reference := range c.Correlation.Rules {
+			correlated := rules[reference]
+			result, err := r.matches(correlated.evaluator, prepareEvents(correlated.rule, correlated.configs, []map[string]interface{}{event})[0])
+			if err != nil {
+				return false, fmt.Errorf("error evaluating rule %s: %w", reference, err)
+			}
+			if !result.Match {
+				continue
+			}
+			if len(matched) == 0 {
+				configs = correlated.configs
+			}
+			matched = append(matched, reference)
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		group := c.groupKey(event, configs)
+		if seen[group] == nil {
+			seen[group] = map[string]bool{}
+		}
+		for _, reference := range matched {
+			seen[group][reference] = true
+		}
+		counts[group]++
+		if values[group] == nil {
+			values[group] = map[string]bool{}
+		}
+		// Events without the field don't have a value to count
+		for _, value := range fieldValues(c.Correlation.Field, configs, event) {
+			values[group][fmt.Sprint(value)] = true
+		}
+	}
+
+	groups := make([]string, 0, len(seen))
+	for group := range seen {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		switch c.Correlation.Type {
+		case "event_count":
+			if satisfied, err := c.conditionSatisfied(float64(counts[group])); err != nil || satisfied {
+				return satisfied, err
+			}
+		case "value_count":
+			if satisfied, err := c.conditionSatisfied(float64(len(values[group]))); err != nil || satisfied {
+				return satisfied, err
+			}
+		case "temporal":
+			if len(seen[group]) == len(c.Correlation.Rules) {
+				return true, nil
+			}
+		default:
+			return false, fmt.Errorf("unsupported correlation type %s", c.Correlation.Type)
+		}
+	}
+	return false, nil
+}
+
+// groupKey identifies the group an event belongs to from its group-by field values (looked up by their names after applying the configs)
+func (c correlationRule) groupKey(event map[string]interface{}, configs []sigma.Config) string {
+	var key []string
+	for _, field := range c.Correlation.GroupBy {
+		key = append(key, fmt.Sprintf("%s=%v", field, fieldValues(field, configs, event)))
+	}
+	sort.Strings(key)
+	return strings.Join(key, ",")
+}
+
+// validate checks the correlation's type and condition operators up front so that an unsupported one is always reported
+// (rather than depending on the events or the order the condition is iterated in)
+func (c correlationRule) validate() error {
+	switch c.Correlation.Type {
+	case "event_count", "value_count", "temporal":
+	default:
+		return fmt.Errorf("unsupported correlation type %s", c.Correlation.Type)
+	}
+	for op := range c.Correlation.Condition {
+		switch op {
+		case "gt", "gte", "lt", "lte", "eq", "neq":
+		default:
+			return fmt.Errorf("unsupported correlation condition %s", op)
+		}
+	}
+	return nil
+}
+
+func (c correlationRule) conditionSatisfied(value float64) (bool, error) {
+	ops := make([]string, 0, len(c.Correlation.Condition))
+	for op := range c.Correlation.Condition {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		threshold := c.Correlation.Condition[op]
+		var satisfied bool
+		switch op {
+		case "gt":
+			satisfied = value > threshold
+		case "gte":
+			satisfied = value >= threshold
+		case "lt":
+			satisfied = value < threshold
+		case "lte":
+			satisfied = value <= threshold
+		case "eq":
+			satisfied = value == threshold
+		case "neq":
+			satisfied = value != threshold
+		default:
+			return false, fmt.Errorf("unsupported correlation condition %s", op)
+		}
+		if !satisfied {
+			return false, nil
+		}
+	}
+	return true, nil
+}
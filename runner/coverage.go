@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"sort"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// FieldCoverage records how many of the fields a rule's detection refers to are present in at least one test case event
+type FieldCoverage struct {
+	Fields      int      `json:"fields"`
+	Exercised   int      `json:"exercised"`
+	Unexercised []string `json:"unexercised,omitempty"`
+}
+
+func (c FieldCoverage) Percentage() float64 {
+	if c.Fields == 0 {
+		return 100
+	}
+	return 100 * float64(c.Exercised) / float64(c.Fields)
+}
+
+func calculateCoverage(rule sigma.Rule, configs []sigma.Config, testCases []TestCase) *FieldCoverage {
+	fields := map[string]bool{}
+	for _, search := range rule.Detection.Searches {
+		for _, matcher := range search.EventMatchers {
+			for _, field := range matcher {
+				fields[field.Field] = true
+			}
+		}
+	}
+
+	coverage := &FieldCoverage{Fields: len(fields)}
+	for field := range fields {
+		if fieldExercised(field, configs, testCases) {
+			coverage.Exercised++
+		} else {
+			coverage.Unexercised = append(coverage.Unexercised, field)
+		}
+	}
+	sort.Strings(coverage.Unexercised)
+	return coverage
+}
+
+// fieldExercised checks whether any test case event contains the field (using the names it's looked up by after applying the configs)
+func fieldExercised(field string, configs []sigma.Config, testCases []TestCase) bool {
+	for _, tc := range testCases {
+		for _, event := range append([]map[string]interface{}{tc.Event}, tc.Events...) {
+			flattened := flattenEvent(event)
+			for _, name := range mappedNames(field, configs) {
+				if _, ok := flattened[topLevelKey(name)]; ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+func TestCalculateCoverage(t *testing.T) {
+	rule, err := sigma.ParseRule([]byte(`
+detection:
+  selection:
+    Foo: foo
+    Bar|contains: bar
+  filter:
+    Baz: baz
+  condition: selection and not filter
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := sigma.ParseConfig([]byte(`
+fieldmappings:
+  Foo: $.foo.nested
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coverage := calculateCoverage(rule, []sigma.Config{config}, []TestCase{
+		{Event: map[string]interface{}{"foo": map[string]interface{}{"nested": "foo"}}},
+		{Event: map[string]interface{}{"Bar": "bar"}},
+	})
+	expected := &FieldCoverage{Fields: 3, Exercised: 2, Unexercised: []string{"Baz"}}
+	if !reflect.DeepEqual(coverage, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, coverage)
+	}
+}
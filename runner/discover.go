@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// DiscoveredFile is a file found when walking the paths being tested, along with its test file (if it has one)
+type DiscoveredFile struct {
+	Path      string
+	Type      sigma.FileType // the type of file as inferred from its contents
+	TestFile  string         // the path of the file's first test file ("" if it doesn't have any)
+	TestFiles []string       // the paths of all the file's test files (see Runner.TestFilenames)
+	TestCases int            // the number of test cases across all of TestFiles
+}
+
+// Discover finds the files which would be tested by Run (in the same order) without evaluating anything
+func (r *Runner) Discover(paths []string) ([]DiscoveredFile, error) {
+	var discovered []DiscoveredFile
+	r.listings = newDirListings()
+	r.Filter.prepare()
+	for _, root := range paths {
+		found, err := r.findRules(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range found {
+			file, err := r.discover(path)
+			if err != nil {
+				return nil, err
+			}
+			discovered = append(discovered, file)
+		}
+	}
+	return discovered, nil
+}
+
+func (r *Runner) discover(path string) (DiscoveredFile, error) {
+	file := DiscoveredFile{Path: path}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	file.Type = sigma.InferFileType(contents)
+	if file.Type != sigma.RuleFile {
+		// A rule collection can start with a document which isn't a rule on its own
+		if rules, _ := parseRules(contents); len(rules) > 0 {
+			file.Type = sigma.RuleFile
+		}
+	}
+	if file.Type != sigma.RuleFile {
+		return file, nil
+	}
+
+	file.TestFiles = r.TestFilenames(path)
+	if len(file.TestFiles) == 0 {
+		return file, nil
+	}
+	file.TestFile = file.TestFiles[0]
+	suite, err := r.readTests(file.TestFiles)
+	if err != nil {
+		return file, err
+	}
+	file.TestCases = len(suite.Cases)
+	return file, nil
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+)
+
+// FieldExplanation describes whether a single field matcher in a rule's detection matched an event
+type FieldExplanation struct {
+	Search  string      `json:"search"`
+	Matcher string      `json:"matcher"` // the field, its modifiers and the values it's compared against
+	Value   interface{} `json:"value"`   // the event's value for the field (nil if it's missing)
+	Matched bool        `json:"matched"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// explain evaluates each field matcher in the rule's detection against the event on its own.
+// The evaluator only reports results for whole searches so each matcher is evaluated as a single-field rule
+// using the same configs and placeholders as the rule itself.
+func (r *Runner) explain(rule sigma.Rule, configs []sigma.Config, expander evaluator.Option, event map[string]interface{}) []FieldExplanation {
+	var explanations []FieldExplanation
+	for _, search := range sortedSearches(rule) {
+		for _, matcher := range rule.Detection.Searches[search].EventMatchers {
+			for _, field := range matcher {
+				single := sigma.Rule{
+					Logsource: rule.Logsource,
+					Detection: sigma.Detection{
+						Searches:   map[string]sigma.Search{search: {EventMatchers: []sigma.EventMatcher{{field}}}},
+						Conditions: sigma.Conditions{{Search: sigma.SearchIdentifier{Name: search}}},
+					},
+				}
+				explanation := FieldExplanation{
+					Search:  search,
+					Matcher: describeMatcher(field),
+					Value:   eventValue(field.Field, configs, event),
+				}
+				result, err := r.matches(evaluator.ForRule(single, evaluator.WithConfig(configs...), expander), event)
+				if err != nil {
+					explanation.Error = err.Error()
+				}
+				explanation.Matched = result.Match
+				explanations = append(explanations, explanation)
+			}
+		}
+	}
+	return explanations
+}
+
+func describeMatcher(field sigma.FieldMatcher) string {
+	name := strings.Join(append([]string{field.Field}, field.Modifiers...), "|")
+	if len(field.Values) == 1 {
+		return fmt.Sprintf("%s: %q", name, field.Values[0])
+	}
+	quoted := make([]string, len(field.Values))
+	for i, value := range field.Values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprintf("%s: [%s]", name, strings.Join(quoted, ", "))
+}
+
+// eventValue finds the value of a field in an event using the names it's looked up by after applying the configs
+func eventValue(field string, configs []sigma.Config, event map[string]interface{}) interface{} {
+	for _, name := range mappedNames(field, configs) {
+		if !strings.HasPrefix(name, "$.") {
+			if value, ok := event[name]; ok {
+				return value
+			}
+			continue
+		}
+		if value, ok := lookupPath(strings.TrimPrefix(name, "$."), event); ok {
+			return value
+		}
+	}
+	return nil
+}
+
+// lookupPath finds a value in nested maps using a dotted path (e.g. foo.bar)
+func lookupPath(path string, event map[string]interface{}) (interface{}, bool) {
+	if value, ok := event[path]; ok {
+		return value, true
+	}
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) < 2 {
+		return nil, false
+	}
+	nested, ok := event[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPath(parts[1], nested)
+}
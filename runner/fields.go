@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// mappedNames returns the names a field is looked up by in an event.
+// As in the evaluator, a field mapped by any of the configs is only looked up by the names it's mapped to (not its name in the rule).
+func mappedNames(field string, configs []sigma.Config) []string {
+	var names []string
+	for _, config := range configs {
+		names = append(names, config.FieldMappings[field].TargetNames...)
+	}
+	if len(names) == 0 {
+		return []string{field}
+	}
+	return names
+}
+
+// describeMappings records the configs applied to a rule and the names each of its fields are looked up by
+func describeMappings(rule sigma.Rule, configs []sigma.Config) *Mappings {
+	mappings := &Mappings{Configs: configTitles(configs), Fields: map[string][]string{}}
+	for _, search := range rule.Detection.Searches {
+		for _, matcher := range search.EventMatchers {
+			for _, field := range matcher {
+				mappings.Fields[field.Field] = mappedNames(field.Field, configs)
+			}
+		}
+	}
+	return mappings
+}
+
+func configTitles(configs []sigma.Config) []string {
+	titles := []string{}
+	for _, config := range configs {
+		title := config.Title
+		if title == "" {
+			title = "untitled config"
+		}
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+// topLevelKey returns the key an event must contain for a name to be found in it.
+// Only JSONPath names (e.g. $.foo.bar) refer to nested fields; other names are used as the key directly.
+func topLevelKey(name string) string {
+	if !strings.HasPrefix(name, "$.") {
+		return name
+	}
+	return strings.SplitN(strings.TrimPrefix(name, "$."), ".", 2)[0]
+}
+
+// usedKeys returns the event keys which a name refers to.
+// As nested events are flattened, a dotted name (e.g. process.parent.name) also uses the maps it's nested in (e.g. process and process.parent).
+func usedKeys(name string) []string {
+	key := topLevelKey(name)
+	keys := []string{key}
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		keys = append(keys, key[:i])
+	}
+	return keys
+}
+
+// unusedEventFields warns about event fields which neither the rule nor any of its configs refer to.
+// These are almost always typos (or the rule's field name being used instead of the name a config maps it to)
+// which make the test case meaningless.
+func unusedEventFields(rule sigma.Rule, configs []sigma.Config, testCases []TestCase) []string {
+	used := map[string]bool{}
+	for _, search := range rule.Detection.Searches {
+		for _, matcher := range search.EventMatchers {
+			for _, field := range matcher {
+				for _, name := range mappedNames(field.Field, configs) {
+					for _, key := range usedKeys(name) {
+						used[key] = true
+					}
+				}
+			}
+		}
+	}
+	mappedTo := map[string][]string{}
+	for _, config := range configs {
+		for field, mapping := range config.FieldMappings {
+			for _, target := range mapping.TargetNames {
+				if strings.HasPrefix(target, "$[") {
+					return nil // bracketed JSONPaths can refer to any field
+				}
+				for _, key := range usedKeys(target) {
+					used[key] = true
+				}
+				mappedTo[field] = append(mappedTo[field], target)
+			}
+		}
+	}
+
+	var warnings []string
+	for i, tc := range testCases {
+		name := tc.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+		unused := map[string]bool{}
+		for _, event := range append([]map[string]interface{}{tc.Event}, tc.Events...) {
+			for key := range event {
+				if !used[key] {
+					unused[key] = true
+				}
+			}
+		}
+		for _, key := range sortedKeys(unused) {
+			warning := fmt.Sprintf("%s: event field %s isn't used by the rule or its configs", name, key)
+			if targets := mappedTo[key]; len(targets) > 0 {
+				warning += fmt.Sprintf(" (configs map it to %s)", strings.Join(targets, ", "))
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// sortedSearches returns the names of the searches in a rule's detection in a consistent order
+func sortedSearches(rule sigma.Rule) []string {
+	var searches []string
+	for name := range rule.Detection.Searches {
+		searches = append(searches, name)
+	}
+	sort.Strings(searches)
+	return searches
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// Filter restricts which rules are tested. The zero value tests every rule.
+type Filter struct {
+	Tags     []string // only test rules with any of these tags
+	ID       string   // only test the rule with exactly this ID
+	Name     string   // only test rules whose title contains this (case-insensitive)
+	Excludes []string // glob patterns for files and directories to skip
+
+	// Logsource only tests rules whose logsource has the same product, category and service (unset fields match anything)
+	Logsource sigma.Logsource
+
+	// Paths only tests the rules in these files, or whose test files are in these files (nil tests every file)
+	Paths []string
+	// IgnoredPaths are files and directories to skip (e.g. those ignored by git)
+	IgnoredPaths []string
+
+	// paths and ignoredPaths are Paths and IgnoredPaths made absolute once per run (see prepare) rather than for every file walked
+	paths, ignoredPaths pathSet
+}
+
+// prepare makes the paths absolute ahead of a run so that checking whether a file is one of them is a lookup
+func (f *Filter) prepare() {
+	f.paths, f.ignoredPaths = nil, nil
+	if f.Paths != nil {
+		f.paths = newPathSet(f.Paths)
+	}
+	if f.IgnoredPaths != nil {
+		f.ignoredPaths = newPathSet(f.IgnoredPaths)
+	}
+}
+
+// Selected checks whether a rule matches the filter
+func (f Filter) Selected(rule sigma.Rule) bool {
+	if len(f.Tags) > 0 && !hasAnyTag(rule, f.Tags) {
+		return false
+	}
+	if f.ID != "" && rule.ID != f.ID {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(strings.ToLower(rule.Title), strings.ToLower(f.Name)) {
+		return false
+	}
+	if !LogsourceMatches(f.Logsource, rule.Logsource) {
+		return false
+	}
+	return true
+}
+
+func hasAnyTag(rule sigma.Rule, tags []string) bool {
+	for _, tag := range tags {
+		for _, ruleTag := range rule.Tags {
+			if strings.EqualFold(tag, ruleTag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Excluded checks whether a path matches any of the Excludes patterns.
+// Patterns are matched against both the whole path and its base name so that e.g. "deprecated" excludes any directory with that name.
+func (f Filter) Excluded(path string) bool {
+	for _, pattern := range f.Excludes {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Included checks whether a path is one of the Paths (or Paths is nil)
+func (f Filter) Included(path string) bool {
+	if f.Paths == nil {
+		return true
+	}
+	if f.paths == nil {
+		f.paths = newPathSet(f.Paths)
+	}
+	return f.paths.contains(path)
+}
+
+// Ignored checks whether a path is one of the IgnoredPaths
+func (f Filter) Ignored(path string) bool {
+	if f.IgnoredPaths == nil {
+		return false
+	}
+	if f.ignoredPaths == nil {
+		f.ignoredPaths = newPathSet(f.IgnoredPaths)
+	}
+	return f.ignoredPaths.contains(path)
+}
+
+// pathSet is a set of absolute paths, which paths being looked up are made absolute to match
+type pathSet map[string]bool
+
+func newPathSet(paths []string) pathSet {
+	set := make(pathSet, len(paths))
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			set[abs] = true
+		}
+	}
+	return set
+}
+
+func (s pathSet) contains(path string) bool {
+	abs, err := filepath.Abs(path)
+	return err == nil && s[abs]
+}
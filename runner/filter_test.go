@@ -0,0 +1,132 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+func TestFilterTags(t *testing.T) {
+	rule := sigma.Rule{Tags: []string{"attack.execution", "attack.t1059"}}
+	tests := map[string]struct {
+		tags     []string
+		selected bool
+	}{
+		"no tags":         {nil, true},
+		"matching tag":    {[]string{"attack.t1059"}, true},
+		"any tag matches": {[]string{"attack.persistence", "attack.execution"}, true},
+		"different case":  {[]string{"ATTACK.Execution"}, true},
+		"no matching tag": {[]string{"attack.persistence"}, false},
+		"tag prefix":      {[]string{"attack"}, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if selected := (Filter{Tags: tt.tags}).Selected(rule); selected != tt.selected {
+				t.Fatalf("expected Selected to be %v, got %v", tt.selected, selected)
+			}
+		})
+	}
+
+	if (Filter{Tags: []string{"attack.execution"}}).Selected(sigma.Rule{}) {
+		t.Fatal("expected a rule without tags not to be selected when filtering by tag")
+	}
+}
+
+func TestFilterIDAndName(t *testing.T) {
+	rule := sigma.Rule{ID: "5f1a2b3c-0000-4000-8000-000000000000", Title: "Suspicious PowerShell Download"}
+	tests := map[string]struct {
+		filter   Filter
+		selected bool
+	}{
+		"exact ID":              {Filter{ID: "5f1a2b3c-0000-4000-8000-000000000000"}, true},
+		"ID prefix":             {Filter{ID: "5f1a2b3c"}, false},
+		"different ID":          {Filter{ID: "00000000-0000-4000-8000-000000000000"}, false},
+		"title substring":       {Filter{Name: "powershell"}, true},
+		"whole title":           {Filter{Name: "Suspicious PowerShell Download"}, true},
+		"different title":       {Filter{Name: "mimikatz"}, false},
+		"ID and name":           {Filter{ID: "5f1a2b3c-0000-4000-8000-000000000000", Name: "download"}, true},
+		"ID but different name": {Filter{ID: "5f1a2b3c-0000-4000-8000-000000000000", Name: "mimikatz"}, false},
+		"name but different ID": {Filter{ID: "00000000-0000-4000-8000-000000000000", Name: "download"}, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if selected := tt.filter.Selected(rule); selected != tt.selected {
+				t.Fatalf("expected Selected to be %v, got %v", tt.selected, selected)
+			}
+		})
+	}
+}
+
+func TestFilterExcluded(t *testing.T) {
+	filter := Filter{Excludes: []string{"deprecated", "rules/experimental", "*_old.yaml"}}
+	tests := map[string]bool{
+		"deprecated":                   true,
+		"rules/deprecated":             true,
+		"rules/experimental":           true,
+		"experimental":                 false,
+		"other/experimental":           false,
+		"rules/rule_old.yaml":          true,
+		"rule_old.yaml":                true,
+		"rules/rule.yaml":              false,
+		"rules/deprecated/rule.yaml":   false, // the directory is skipped while walking rather than each file being excluded
+		"rules/deprecated_rules":       false,
+		"rules/experimental/rule.yaml": false,
+	}
+	for path, excluded := range tests {
+		t.Run(path, func(t *testing.T) {
+			if filter.Excluded(path) != excluded {
+				t.Fatalf("expected Excluded(%q) to be %v", path, excluded)
+			}
+		})
+	}
+
+	if (Filter{}).Excluded("rules/rule.yaml") {
+		t.Fatal("expected nothing to be excluded without any patterns")
+	}
+}
+
+func TestFilteredRulesAreNotSkipped(t *testing.T) {
+	path := writeRule(t, "tags:\n  - attack.persistence\ndetection:\n  selection:\n    a: foo\n  condition: selection\n", "event:\n  a: foo\n")
+	report, err := (&Runner{Filter: Filter{Tags: []string{"attack.execution"}}, AllowEmpty: true}).Run([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 0 || !report.Passed {
+		t.Fatalf("expected the rule to be filtered out rather than reported, got %+v", report)
+	}
+}
+
+func TestFilterPathSets(t *testing.T) {
+	filter := Filter{
+		Paths:        []string{"rules/a.yaml", "./rules/b_test.yaml"},
+		IgnoredPaths: []string{"rules/ignored"},
+	}
+	tests := map[string]struct {
+		included, ignored bool
+	}{
+		"rules/a.yaml":          {true, false},
+		"./rules/a.yaml":        {true, false},
+		"rules/../rules/a.yaml": {true, false},
+		"rules/b_test.yaml":     {true, false},
+		"rules/c.yaml":          {false, false},
+		"rules/ignored":         {false, true},
+		"rules/ignored/":        {false, true},
+		"rules/ignored/d.yaml":  {false, false},
+	}
+	prepared := filter
+	prepared.prepare()
+	for name, f := range map[string]Filter{"unprepared": filter, "prepared": prepared} {
+		for path, tt := range tests {
+			if f.Included(path) != tt.included {
+				t.Errorf("%s: expected Included(%q) to be %v", name, path, tt.included)
+			}
+			if f.Ignored(path) != tt.ignored {
+				t.Errorf("%s: expected Ignored(%q) to be %v", name, path, tt.ignored)
+			}
+		}
+	}
+
+	if !(Filter{}).Included("rules/c.yaml") || (Filter{}).Ignored("rules/c.yaml") {
+		t.Fatal("expected the zero Filter to include every path and ignore none")
+	}
+}
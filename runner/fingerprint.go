@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// fingerprint hashes the rule's ID, the outcome of each of its test cases and the configs it was evaluated with.
+// It's the same across runs unless one of those changes (so that downstream systems can detect changes in behaviour).
+func fingerprint(result RuleResult) string {
+	h := sha256.New()
+	id := result.ID
+	if id == "" {
+		// Rules without an ID are identified by where they are instead
+		id = result.Name()
+	}
+	fmt.Fprintf(h, "id=%q status=%q error=%q\n", id, result.Status, result.Error)
+	for _, c := range result.Cases {
+		fmt.Fprintf(h, "case %d name=%q passed=%t error=%q\n", c.Index, c.Name, c.Passed, c.Error)
+		if c.Observed != "" {
+			// Added separately so that the fingerprints of rules without any unknown expectations are unchanged
+			fmt.Fprintf(h, "case %d observed=%q\n", c.Index, c.Observed)
+		}
+	}
+	writeConfigs(h, result.configs)
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func writeConfigs(w io.Writer, configs []sigma.Config) {
+	for _, config := range configs {
+		// Map keys are sorted when encoding JSON so the encoding is stable
+		encoded, err := json.Marshal(config)
+		if err != nil {
+			// Configs only contain values decoded from YAML so can always be encoded but fall back to the title just in case
+			encoded = []byte(config.Title)
+		}
+		fmt.Fprintf(w, "config %s\n", encoded)
+	}
+}
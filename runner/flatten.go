@@ -0,0 +1,53 @@
+package runner
+
+// The evaluator looks fields up by their exact key so a rule referring to process.name can't see {"process": {"name": ...}}.
+// Events are flattened before evaluation so that test cases can be written as natural nested JSON.
+
+// flattenEvents flattens each of the events (see flattenEvent)
+func flattenEvents(events []map[string]interface{}) []map[string]interface{} {
+	flattened := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		flattened[i] = flattenEvent(event)
+	}
+	return flattened
+}
+
+// flattenEvent returns a copy of the event which also contains the values of nested maps under dotted keys
+// (e.g. {"process": {"name": "x"}} also gets "process.name": "x").
+// The nested maps are kept so that JSONPath field mappings still work and keys already in the event take precedence.
+func flattenEvent(event map[string]interface{}) map[string]interface{} {
+	if !hasNestedMap(event) {
+		return event
+	}
+	flattened := make(map[string]interface{}, len(event))
+	for key, value := range event {
+		flattened[key] = value
+	}
+	for key, value := range event {
+		if nested, ok := value.(map[string]interface{}); ok {
+			addFlattened(flattened, key, nested)
+		}
+	}
+	return flattened
+}
+
+func addFlattened(flattened map[string]interface{}, prefix string, nested map[string]interface{}) {
+	for key, value := range nested {
+		dotted := prefix + "." + key
+		if _, ok := flattened[dotted]; !ok {
+			flattened[dotted] = value
+		}
+		if deeper, ok := value.(map[string]interface{}); ok {
+			addFlattened(flattened, dotted, deeper)
+		}
+	}
+}
+
+func hasNestedMap(event map[string]interface{}) bool {
+	for _, value := range event {
+		if _, ok := value.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// The evaluator doesn't support keyword searches so they're rewritten into a regular expression matcher on keywordsField.
+// For a plain string event (TestCase.Message) this field is the message itself, otherwise it's every value in the event.
+const keywordsField = "keywords()"
+
+// keywordsMatcher matches any of the keywords anywhere in the value (ignoring case) with * and ? as wildcards
+func keywordsMatcher(keywords []string) sigma.FieldMatcher {
+	patterns := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		pattern := regexp.QuoteMeta(keyword)
+		pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+		pattern = strings.ReplaceAll(pattern, `\?`, ".")
+		patterns[i] = "(?is)" + pattern
+	}
+	return sigma.FieldMatcher{Field: keywordsField, Modifiers: []string{"re"}, Values: patterns}
+}
+
+func hasKeywords(rule sigma.Rule) bool {
+	for _, search := range rule.Detection.Searches {
+		if len(search.Keywords) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// markKeywords adds every value in each event to keywordsField so that the rule's keywords can search them
+// (events which already have keywordsField are plain string events so are left as they are)
+func markKeywords(rule sigma.Rule, events []map[string]interface{}) []map[string]interface{} {
+	if !hasKeywords(rule) {
+		return events
+	}
+	marked := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		if _, ok := event[keywordsField]; ok {
+			marked[i] = event
+			continue
+		}
+		marked[i] = make(map[string]interface{}, len(event)+1)
+		var values []interface{}
+		for key, value := range event {
+			marked[i][key] = value
+			values = appendValues(values, value)
+		}
+		marked[i][keywordsField] = values
+	}
+	return marked
+}
+
+// appendValues appends the scalar values within value (i.e. the elements of lists and values of nested maps)
+func appendValues(values []interface{}, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, nested := range v {
+			values = appendValues(values, nested)
+		}
+	case []interface{}:
+		for _, element := range v {
+			values = appendValues(values, element)
+		}
+	case nil:
+	default:
+		values = append(values, v)
+	}
+	return values
+}
+
+// checkMessage reports test cases with a plain string event for rules without any keywords to search it
+func checkMessage(rule sigma.Rule, tc TestCase) error {
+	if tc.Message != "" && !hasKeywords(rule) {
+		return fmt.Errorf("the event is a string but the rule doesn't have any keyword searches")
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// levels are the rule levels allowed by the Sigma specification (in increasing severity)
+var levels = []string{"informational", "low", "medium", "high", "critical"}
+
+// checkLevel reports rules which don't have one of the allowed levels.
+// The evaluator doesn't report a level when a rule matches so the level can't be asserted by test cases.
+func checkLevel(rule sigma.Rule) error {
+	if rule.Level == "" {
+		return fmt.Errorf("rule doesn't have a level (expected one of %s)", strings.Join(levels, ", "))
+	}
+	for _, level := range levels {
+		if rule.Level == level {
+			return nil
+		}
+	}
+	return fmt.Errorf("rule has invalid level %q (expected one of %s)", rule.Level, strings.Join(levels, ", "))
+}
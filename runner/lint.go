@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestFileProblem is a problem with a test file found by LintTests
+type TestFileProblem struct {
+	Path    string // the test file
+	Rule    string // the rule file it's for
+	Problem string
+}
+
+// LintTests checks that the test files of the rules found in the given paths can be parsed without evaluating anything.
+// As well as parse errors, it reports fields which aren't part of the test file format (which are otherwise ignored)
+// and test files without any test cases.
+func (r *Runner) LintTests(paths []string) ([]TestFileProblem, error) {
+	r.listings = newDirListings()
+	r.Filter.prepare()
+	var problems []TestFileProblem
+	for _, root := range paths {
+		found, err := r.findRules(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range found {
+			for _, testFile := range r.TestFilenames(path) {
+				for _, problem := range lintTestFile(testFile) {
+					problems = append(problems, TestFileProblem{Path: testFile, Rule: path, Problem: problem})
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+func lintTestFile(path string) []string {
+	suite, err := getTestCases(path)
+	if err != nil {
+		// Unknown fields can't be checked if the file can't be parsed at all
+		return []string{err.Error()}
+	}
+	problems, err := unknownFields(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if len(suite.Cases) == 0 && !suite.ExpectParseError {
+		problems = append(problems, "doesn't contain any test cases")
+	}
+	return problems
+}
+
+// checkUnknownFields returns an error describing any fields in a test file which aren't part of the test file format
+func checkUnknownFields(path string) error {
+	problems, err := unknownFields(path)
+	if err != nil || len(problems) == 0 {
+		return err
+	}
+	return fmt.Errorf("unknown fields in test file: %s", strings.Join(problems, "; "))
+}
+
+// unknownFields decodes each test case in a test file with a strict decoder to find fields which aren't part of the test file format
+func unknownFields(path string) ([]string, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	documents, err := decodeTestDocuments(contents)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing test cases: %w", err)
+	}
+
+	var problems []string
+	for i, document := range documents {
+		if isAnchorsDocument(document) || isEmptyDocument(document) || isConfigDocument(document) || isParseErrorDocument(document) {
+			continue
+		}
+		var target interface{}
+		if hasKey(document, "testcases") {
+			target = &TestCases{}
+		} else {
+			stringEvent(&document)
+			maybeMatch(&document)
+			target = &TestCase{}
+		}
+		// Aliases are resolved first as the anchors they refer to may be in other documents
+		encoded, err := yaml.Marshal(resolveAliases(&document))
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(encoded))
+		decoder.KnownFields(true)
+		err = decoder.Decode(target)
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("document %d: %v", i+1, err))
+			}
+			continue
+		}
+		// The line numbers are of the re-encoded document rather than the test file so are left out
+		for _, message := range typeErr.Errors {
+			problems = append(problems, fmt.Sprintf("document %d: %s", i+1, lineNumber.ReplaceAllString(message, "")))
+		}
+	}
+	return problems, nil
+}
+
+var lineNumber = regexp.MustCompile(`^line \d+: `)
+
+// resolveAliases returns a copy of node with each alias replaced by the node it refers to
+func resolveAliases(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		return resolveAliases(node.Alias)
+	}
+	resolved := *node
+	resolved.Anchor = ""
+	resolved.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		resolved.Content[i] = resolveAliases(child)
+	}
+	return &resolved
+}
@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// dirListings caches the names of the files in each directory during a run.
+// Finding a rule's additional test files means listing its directory, which would otherwise be repeated for every rule in it.
+// A nil *dirListings reads directories without caching.
+type dirListings struct {
+	mu    sync.Mutex
+	names map[string][]string
+}
+
+func newDirListings() *dirListings {
+	return &dirListings{names: map[string][]string{}}
+}
+
+// list returns the names of the files in dir (nil if it can't be read)
+func (d *dirListings) list(dir string) []string {
+	if d == nil {
+		return readDirNames(dir)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names, ok := d.names[dir]
+	if !ok {
+		names = readDirNames(dir)
+		d.names[dir] = names
+	}
+	return names
+}
+
+// exists checks whether a file exists using the listing of its directory
+func (d *dirListings) exists(path string) bool {
+	base := filepath.Base(path)
+	for _, name := range d.list(filepath.Dir(path)) {
+		if name == base {
+			return true
+		}
+	}
+	return false
+}
+
+func readDirNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
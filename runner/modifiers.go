@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// expandModifiers rewrites field matchers using modifiers which the evaluator doesn't support into equivalent ones which it does.
+// The rule's searches are copied so that the original (which may be cached) is left untouched.
+func expandModifiers(rule sigma.Rule) sigma.Rule {
+	searches := make(map[string]sigma.Search, len(rule.Detection.Searches))
+	for name, search := range rule.Detection.Searches {
+		expanded := sigma.Search{}
+		if len(search.Keywords) > 0 {
+			expanded.EventMatchers = append(expanded.EventMatchers, sigma.EventMatcher{keywordsMatcher(search.Keywords)})
+		}
+		for _, matcher := range search.EventMatchers {
+			expandedMatcher := make(sigma.EventMatcher, 0, len(matcher))
+			for _, field := range matcher {
+				expandedMatcher = append(expandedMatcher, expandField(field)...)
+			}
+			expanded.EventMatchers = append(expanded.EventMatchers, expandedMatcher)
+		}
+		searches[name] = expanded
+	}
+	rule.Detection.Searches = searches
+	return rule
+}
+
+// expandField rewrites a single field matcher (which can need several field matchers, all of which must match, to be equivalent)
+func expandField(field sigma.FieldMatcher) []sigma.FieldMatcher {
+	var modifiers []string
+	var flags string
+	all := false
+	original, encoded := field.Values, hasModifier(field, "base64offset")
+	if modifier, values, ok := comparison(field); ok {
+		// The comparison (including any all modifier) is evaluated by markComparisons
+		return []sigma.FieldMatcher{{Field: comparisonField(field.Field, modifier, values), Values: []string{"true"}}}
+	}
+	for _, modifier := range field.Modifiers {
+		switch modifier {
+		case "all":
+			// The evaluator only supports all as the last modifier (but the specification allows it anywhere)
+			all = true
+		case "i", "m", "s":
+			// The regular expression flags (re|i etc.) become inline flags in the expression itself
+			if !hasModifier(field, "re") {
+				modifiers = append(modifiers, modifier)
+				continue
+			}
+			flags += modifier
+		case "exists":
+			field.Field = existsField(field.Field)
+		case "base64offset":
+			var values []string
+			for _, value := range field.Values {
+				values = append(values, base64Offsets(value)...)
+			}
+			field.Values = values
+		default:
+			modifiers = append(modifiers, modifier)
+		}
+	}
+	field.Modifiers = modifiers
+	if flags != "" {
+		values := make([]string, len(field.Values))
+		for i, value := range field.Values {
+			values[i] = "(?" + flags + ")" + value
+		}
+		field.Values = values
+	}
+	if !all {
+		return []sigma.FieldMatcher{field}
+	}
+	if encoded {
+		// Each value's encodings are alternatives so requiring all of them to match would be wrong:
+		// instead every value gets its own field matcher which matches any of its encodings
+		split := make([]sigma.FieldMatcher, len(original))
+		for i, value := range original {
+			split[i] = field
+			split[i].Values = base64Offsets(value)
+		}
+		return split
+	}
+	field.Modifiers = append(field.Modifiers, "all")
+	return []sigma.FieldMatcher{field}
+}
+
+// checkRegexes reports regular expressions which can't be compiled as the evaluator treats them as never matching.
+// Expressions are compiled with Go's RE2 syntax so e.g. lookarounds and backreferences aren't supported.
+func checkRegexes(rule sigma.Rule) error {
+	for _, name := range sortedSearches(rule) {
+		for _, matcher := range rule.Detection.Searches[name].EventMatchers {
+			for _, field := range matcher {
+				if !hasModifier(field, "re") {
+					continue
+				}
+				for _, expanded := range expandField(field) {
+					for _, value := range expanded.Values {
+						if _, err := regexp.Compile(value); err != nil {
+							return fmt.Errorf("invalid regular expression for %s in %s: %w", field.Field, name, err)
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// base64Offsets returns the parts of value's base64 encoding which don't depend on the surrounding data,
+// for each of the three offsets (modulo 3) it could appear at within a longer encoded string
+func base64Offsets(value string) []string {
+	startOffsets := []int{0, 2, 3}
+	endOffsets := []int{0, 3, 2} // the number of characters to drop from the end
+	offsets := make([]string, 3)
+	for i := range offsets {
+		padded := make([]byte, i, i+len(value))
+		for j := range padded {
+			padded[j] = ' '
+		}
+		encoded := base64.StdEncoding.EncodeToString(append(padded, value...))
+		offsets[i] = encoded[startOffsets[i] : len(encoded)-endOffsets[(len(value)+i)%3]]
+	}
+	return offsets
+}
+
+// existsField is the name a field checked by the exists modifier is rewritten to.
+// The evaluator can't tell a missing field from one set to null so markExistence adds whether the field is present to each event.
+func existsField(field string) string {
+	return "exists(" + field + ")"
+}
+
+// prepareEvents adds the fields which the rewritten rule (see expandModifiers) relies on to copies of the events
+func prepareEvents(rule sigma.Rule, configs []sigma.Config, events []map[string]interface{}) []map[string]interface{} {
+	return markKeywords(rule, markComparisons(rule, configs, markExistence(rule, configs, flattenEvents(events))))
+}
+
+// markExistence adds whether each field checked by the rule's exists modifiers is present to copies of the events
+func markExistence(rule sigma.Rule, configs []sigma.Config, events []map[string]interface{}) []map[string]interface{} {
+	var fields []string
+	for _, search := range rule.Detection.Searches {
+		for _, matcher := range search.EventMatchers {
+			for _, field := range matcher {
+				if hasModifier(field, "exists") {
+					fields = append(fields, field.Field)
+				}
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return events
+	}
+
+	marked := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		marked[i] = make(map[string]interface{}, len(event)+len(fields))
+		for key, value := range event {
+			marked[i][key] = value
+		}
+		for _, field := range fields {
+			marked[i][existsField(field)] = fieldPresent(field, configs, event)
+		}
+	}
+	return marked
+}
+
+// fieldPresent checks whether an event contains a field (even if its value is null) using the names it's looked up by after applying the configs
+func fieldPresent(field string, configs []sigma.Config, event map[string]interface{}) bool {
+	for _, name := range mappedNames(field, configs) {
+		if !strings.HasPrefix(name, "$.") {
+			if _, ok := event[name]; ok {
+				return true
+			}
+			continue
+		}
+		if _, ok := lookupPath(strings.TrimPrefix(name, "$."), event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasModifier(field sigma.FieldMatcher, modifier string) bool {
+	for _, m := range field.Modifiers {
+		if m == modifier {
+			return true
+		}
+	}
+	return false
+}
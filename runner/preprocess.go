@@ -0,0 +1,65 @@
+package runner
+
+import "sort"
+
+// RenameFields returns a function for Runner.Preprocess which renames fields in events (e.g. from a vendor's names to those used by rules).
+// Fields in nested maps can be renamed using their dotted path (e.g. vendor.cmd).
+// Every field is renamed from its value in the original event so chained renames (e.g. a to b and b to c) don't affect each other,
+// and if several fields are renamed to the same name the last in sorted order wins.
+func RenameFields(renames map[string]string) func(event map[string]interface{}) map[string]interface{} {
+	froms := make([]string, 0, len(renames))
+	for from := range renames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	return func(event map[string]interface{}) map[string]interface{} {
+		renamed := make(map[string]interface{}, len(event))
+		for key, value := range event {
+			renamed[key] = value
+		}
+		// The renamed fields are all removed before any are added so that a field renamed to another's old name isn't removed too
+		values := make([]interface{}, len(froms))
+		found := make([]bool, len(froms))
+		for i, from := range froms {
+			values[i], found[i] = lookupPath(from, event)
+			if found[i] {
+				delete(renamed, from)
+			}
+		}
+		for i, from := range froms {
+			if found[i] {
+				renamed[renames[from]] = values[i]
+			}
+		}
+		return renamed
+	}
+}
+
+// preprocess applies Preprocess to copies of the events
+func (r *Runner) preprocess(events []map[string]interface{}) []map[string]interface{} {
+	if r.Preprocess == nil {
+		return events
+	}
+	preprocessed := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		preprocessed[i] = r.Preprocess(event)
+	}
+	return preprocessed
+}
+
+// preprocessCases applies Preprocess to copies of the test cases' events (for checks which look at the events without evaluating them)
+func (r *Runner) preprocessCases(testCases []TestCase) []TestCase {
+	if r.Preprocess == nil {
+		return testCases
+	}
+	preprocessed := make([]TestCase, len(testCases))
+	for i, tc := range testCases {
+		if tc.Event != nil {
+			tc.Event = r.Preprocess(tc.Event)
+		}
+		tc.Events = r.preprocess(tc.Events)
+		preprocessed[i] = tc
+	}
+	return preprocessed
+}
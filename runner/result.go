@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// The status of a tested rule
+const (
+	StatusPass  = "PASS"
+	StatusFail  = "FAIL"
+	StatusSkip  = "SKIP"
+	StatusError = "ERROR"
+	// StatusUnconfigured is used (instead of an error) for rules which no config applies to when AllowUnconfigured is set
+	StatusUnconfigured = "UNCONFIGURED"
+	// StatusUntested is used (instead of skipping) for rules without any test cases when RequireTests is set
+	StatusUntested = "UNTESTED"
+)
+
+// Report is the outcome of testing all the rules in a run
+type Report struct {
+	Results []RuleResult
+	Passed  bool // whether the run succeeded (i.e. none of the results are fatal)
+	Errored bool // whether any rule couldn't be tested (i.e. any of the results have StatusError)
+
+	// DuplicateIDs maps rule IDs used in more than one file to those files' paths (only populated when Runner.CheckDuplicateIDs is set)
+	DuplicateIDs map[string][]string
+}
+
+// RuleResult is the outcome of testing a single rule
+type RuleResult struct {
+	Path   string
+	Rule   string // identifies the rule within a rule collection
+	Title  string
+	ID     string
+	Status string
+	Error  string
+	Cases  []CaseResult // in the order the test cases appear in the test file(s)
+
+	// Warnings are problems with the test cases (or configs) which don't fail the run (only populated when Runner.CheckEventFields, Runner.StrictTypes or Runner.Verbose is set)
+	Warnings []string
+
+	Coverage *FieldCoverage // only populated when Runner.Coverage is set
+	Mappings *Mappings      // only populated when Runner.ShowMappings is set
+	Duration time.Duration  // how long it took to evaluate the rule's test cases
+
+	Benchmark *Benchmark // only populated when Runner.Benchmark is set
+
+	// Fingerprint is a hash of the rule's ID, the outcome of each test case and the configs it was evaluated with (only populated when Runner.Fingerprint is set).
+	// It's stable across runs unless one of those changes.
+	Fingerprint string
+
+	configs []sigma.Config // the configs the rule was evaluated with
+
+	Fatal bool // whether this result should fail the run
+}
+
+// Name identifies the rule for display, distinguishing between the rules in a collection
+func (r RuleResult) Name() string {
+	if r.Rule == "" {
+		return r.Path
+	}
+	return fmt.Sprintf("%s (%s)", r.Path, r.Rule)
+}
+
+// Failures returns the test cases which didn't behave as expected, in the order they appear in the test file(s)
+func (r RuleResult) Failures() []CaseResult {
+	var failures []CaseResult
+	for _, c := range r.Cases {
+		if !c.Passed {
+			failures = append(failures, c)
+		}
+	}
+	return failures
+}
+
+// Unknown returns the test cases with an unknown expectation, whose observed outcome is reported without passing or failing them
+func (r RuleResult) Unknown() []CaseResult {
+	var unknown []CaseResult
+	for _, c := range r.Cases {
+		if c.Observed != "" {
+			unknown = append(unknown, c)
+		}
+	}
+	return unknown
+}
+
+// Mappings describes how the configs were applied to a rule
+type Mappings struct {
+	Configs []string            `json:"configs"` // the titles of the configs applied to the rule (in the order they're applied)
+	Fields  map[string][]string `json:"fields"`  // maps each field in the rule's detection to the names it's looked up by in events
+}
+
+// CaseResult is the outcome of a single test case
+type CaseResult struct {
+	Index int                    `json:"index"` // the position of the test case in the test file
+	Name  string                 `json:"name,omitempty"`
+	Event map[string]interface{} `json:"event"`
+	// Message is set instead of Event for plain string events
+	Message string `json:"message,omitempty"`
+	Passed  bool   `json:"-"`                // only failing cases are included in JSON output
+	Reason  string `json:"reason,omitempty"` // why the test case failed
+	Error   string `json:"error,omitempty"`  // set if the rule failed to evaluate this event
+	// Observed is set for test cases with an unknown expectation (which always pass) to whether the rule matched
+	Observed string `json:"observed,omitempty"`
+
+	// SearchResults records whether each search in the rule's detection matched the event (only populated for failures when Runner.Verbose is set)
+	SearchResults map[string]bool `json:"search_results,omitempty"`
+	// Explanation records whether each field matcher in the rule's detection matched the event (only populated for failures when Runner.Explain is set)
+	Explanation []FieldExplanation `json:"explanation,omitempty"`
+}
+
+// DisplayName identifies the test case by its name (or position if it doesn't have one)
+func (c CaseResult) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("case %d", c.Index+1)
+}
@@ -0,0 +1,1104 @@
+// Package runner tests Sigma rules against the test cases stored alongside them.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+)
+
+// Runner finds rules and runs their test cases. The zero value tests rules without any configs.
+type Runner struct {
+	// Configs are used when evaluating rules (only those relevant to a rule's logsource are applied)
+	Configs []sigma.Config
+	// ExcludedConfigs were loaded but aren't used (e.g. because they don't list this backend).
+	// With Verbose, rules which any of them would apply to are warned about as the exclusion is usually a mistake.
+	ExcludedConfigs []sigma.Config
+	// Recursive tests the rules in subdirectories of the paths being tested
+	Recursive bool
+	// AllowEmpty lets Run succeed without finding any rules to test (otherwise it returns an error)
+	AllowEmpty bool
+	// Jobs is the number of rules to test concurrently (at least one rule is always tested)
+	Jobs int
+	// RulePatterns are glob patterns matched against the base name of files to find rules ("*.yaml" and "*.yml" if empty)
+	RulePatterns []string
+	// TestSuffix is added to a rule's filename (before the extension) to find its test file ("_test" if empty)
+	TestSuffix string
+	// TestDir is a directory of test files mirroring the layout of RulesDir (test files are next to their rules if empty).
+	// Rules outside RulesDir still have their test files next to them.
+	TestDir string
+	// RulesDir is the directory whose layout TestDir mirrors ("." if empty)
+	RulesDir string
+	// Timeout is the maximum time to spend evaluating a single event (0 means no limit)
+	Timeout time.Duration
+	// FailFast stops testing after the first failing rule
+	FailFast bool
+	// Coverage records how many of each rule's detection fields are exercised by its test cases
+	Coverage bool
+	// RequireTests fails rules which don't have any test cases (instead of skipping them)
+	RequireTests bool
+	// CheckConfigured reports rules which no config applies to as errors instead of evaluating them with every config
+	CheckConfigured bool
+	// AllowUnconfigured reports rules which no config applies to (implying CheckConfigured) without failing the run
+	AllowUnconfigured bool
+	// Verbose records which searches matched for failing test cases
+	Verbose bool
+	// ShowMappings records which configs were applied to each rule and how they map its fields
+	ShowMappings bool
+	// Explain records whether each field in the rule's detection matched for failing test cases
+	Explain bool
+	// CheckDuplicateIDs fails the run if any rule ID is used in more than one file
+	CheckDuplicateIDs bool
+	// CheckEventFields warns about test case event fields which aren't used by the rule or its configs
+	CheckEventFields bool
+	// CheckLevels reports rules without one of the levels allowed by the Sigma specification as errors
+	CheckLevels bool
+	// WarningsAsErrors reports rules which would otherwise pass with warnings as errors
+	WarningsAsErrors bool
+	// StrictTestFiles reports rules whose test files contain fields which aren't part of the test file format (see LintTests) as errors
+	StrictTestFiles bool
+	// CaseInsensitiveFields lowercases the field names in rules, configs and test case events before evaluating them
+	// so that a rule using CommandLine matches an event with commandline (correlation rules are still case-sensitive)
+	CaseInsensitiveFields bool
+	// StrictTypes warns about test case event values which are a different type (string, number or boolean) to the values the rule compares them to
+	StrictTypes bool
+	// Fingerprint records a hash of each rule's outcome (see RuleResult.Fingerprint)
+	Fingerprint bool
+	// Shuffle tests rules in a random order (seeded by Seed) to surface any dependencies on the order they're tested in
+	Shuffle bool
+	Seed    int64
+	// Benchmark repeatedly evaluates each rule's test case events for this long after testing it to measure its throughput (0 disables benchmarking).
+	// Rules using aggregations aren't benchmarked as their state would grow with every evaluation.
+	Benchmark time.Duration
+	// Logger receives messages describing each decision made while finding and testing rules (nil disables logging)
+	Logger *slog.Logger
+	// Placeholders are the values placeholders expand to for every rule (values declared in a test file take precedence)
+	Placeholders map[string][]string
+	// Preprocess (if set) is applied to each test case event before evaluating it (e.g. to normalise vendor-specific field names as a production pipeline would).
+	// Results still report the events as they were written.
+	Preprocess func(event map[string]interface{}) map[string]interface{}
+	// Filter restricts which rules are tested
+	Filter Filter
+	// Cache stores parsed rules and test cases so they don't need to be re-parsed (nil disables caching)
+	Cache *Cache
+
+	// OnResult (if set) is called with each result as soon as it's available, in the order the rules were found.
+	// Returning an error stops the run.
+	OnResult func(RuleResult) error
+	// OnProgress is called (in order) after each file is tested with the number of files tested so far and the total number found
+	OnProgress func(tested, total int)
+
+	listings *dirListings
+}
+
+// Run tests all the rules found in the given paths (which may be files or directories)
+func (r *Runner) Run(paths []string) (Report, error) {
+	report := Report{Passed: true}
+	r.listings = newDirListings()
+	r.Filter.prepare()
+	var shuffle *rand.Rand
+	if r.Shuffle {
+		shuffle = rand.New(rand.NewSource(r.Seed))
+	}
+
+	// Every path is searched before testing any rules so that progress can be reported against the total
+	found := make([][]string, len(paths))
+	total := 0
+	for i, path := range paths {
+		var err error
+		if found[i], err = r.findRules(path); err != nil {
+			return report, err
+		}
+		total += len(found[i])
+	}
+	tested := 0
+	progress := func() {
+		tested++
+		if r.OnProgress != nil {
+			r.OnProgress(tested, total)
+		}
+	}
+
+	for _, rulePaths := range found {
+		if err := r.run(rulePaths, &report, shuffle, progress); err != nil {
+			return report, err
+		}
+		if !report.Passed && r.FailFast {
+			break
+		}
+	}
+
+	// Finding nothing to test is usually a mistake (e.g. a misspelt path) which would otherwise look like a passing run
+	if len(report.Results) == 0 && !r.AllowEmpty {
+		report.Passed = false
+		return report, fmt.Errorf("no rules found under %s", strings.Join(paths, ", "))
+	}
+
+	if r.CheckDuplicateIDs {
+		report.DuplicateIDs = duplicateIDs(report.Results)
+		if len(report.DuplicateIDs) > 0 {
+			report.Passed = false
+		}
+	}
+	return report, nil
+}
+
+// duplicateIDs finds the IDs used by rules in more than one file, returning the paths of the files using each
+func duplicateIDs(results []RuleResult) map[string][]string {
+	paths := map[string][]string{}
+	for _, result := range results {
+		if result.ID == "" {
+			continue
+		}
+		seen := paths[result.ID]
+		if len(seen) > 0 && seen[len(seen)-1] == result.Path {
+			continue // rules in a collection share a path
+		}
+		paths[result.ID] = append(seen, result.Path)
+	}
+
+	duplicates := map[string][]string{}
+	for id, idPaths := range paths {
+		if len(idPaths) > 1 {
+			duplicates[id] = idPaths
+		}
+	}
+	return duplicates
+}
+
+// run tests the rules in the files at paths, calling progress after each file is tested
+func (r *Runner) run(paths []string, report *Report, shuffle *rand.Rand, progress func()) error {
+	if shuffle != nil {
+		shuffle.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+	}
+
+	// Test files concurrently but store the results by index so that they're reported in walk (or shuffled) order
+	results := make([][]RuleResult, len(paths))
+	errs := make([]error, len(paths))
+	done := make([]chan struct{}, len(paths))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < r.Jobs || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = r.testPath(paths[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := range paths {
+			select {
+			case indexes <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	// Stop testing any more files once we've returned
+	defer wg.Wait()
+	defer close(stop)
+
+	for i := range paths {
+		<-done[i]
+		if errs[i] != nil {
+			report.Passed = false
+			return errs[i]
+		}
+		if err := r.addResults(report, results[i]); err != nil {
+			return err
+		}
+		progress()
+		if !report.Passed && r.FailFast {
+			return nil
+		}
+	}
+	return nil
+}
+
+// findRules walks root to find the files which could contain rules
+func (r *Runner) findRules(root string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			switch {
+			case path == root:
+				return nil
+			case !r.Recursive:
+				r.log().Debug("skipping directory", "path", path, "reason", "not recursive")
+				return filepath.SkipDir
+			case info.Name() == ".git":
+				// Git's metadata never contains rules but can be very large
+				r.log().Debug("skipping directory", "path", path, "reason", "git metadata")
+				return filepath.SkipDir
+			case r.Filter.Excluded(path):
+				r.log().Debug("skipping directory", "path", path, "reason", "excluded")
+				return filepath.SkipDir
+			case r.Filter.Ignored(path):
+				r.log().Debug("skipping directory", "path", path, "reason", "ignored")
+				return filepath.SkipDir
+			default:
+				return nil
+			}
+		}
+
+		switch {
+		case !r.MatchesRulePattern(path):
+			r.log().Debug("skipping file", "path", path, "reason", "doesn't match the rule patterns")
+		case r.isTestFile(path):
+			// Test files are never rules, even if they look like one
+			r.log().Debug("skipping file", "path", path, "reason", "test file")
+		case r.Filter.Excluded(path):
+			r.log().Debug("skipping file", "path", path, "reason", "excluded")
+		case r.Filter.Ignored(path):
+			r.log().Debug("skipping file", "path", path, "reason", "ignored")
+		case !r.Filter.Included(path) && !r.anyIncluded(r.testFilenames(path)):
+			// A rule is still tested if only its test file is included (e.g. only the test file changed)
+			r.log().Debug("skipping file", "path", path, "reason", "not included")
+		default:
+			r.log().Debug("found rule file", "path", path)
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func (r *Runner) anyIncluded(paths []string) bool {
+	for _, path := range paths {
+		if r.Filter.Included(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// discardLogger is used when no Logger is set (its level is too high for anything to be logged)
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(math.MaxInt32)}))
+
+func (r *Runner) log() *slog.Logger {
+	if r.Logger == nil {
+		return discardLogger
+	}
+	return r.Logger
+}
+
+// addResults records results in the report (in order), passing each to OnResult
+func (r *Runner) addResults(report *Report, results []RuleResult) error {
+	for _, result := range results {
+		if result.Fatal {
+			report.Passed = false
+		}
+		if result.Status == StatusError {
+			report.Errored = true
+		}
+		report.Results = append(report.Results, result)
+		if r.OnResult != nil {
+			if err := r.OnResult(result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunReader tests the rules read from rule (e.g. an unsaved editor buffer or stdin) using the test cases in testsPath.
+// name identifies the rule in results. The usual test file naming convention (and the Cache) isn't used.
+func (r *Runner) RunReader(name string, rule io.Reader, testsPath string) (Report, error) {
+	report := Report{Passed: true}
+	contents, err := io.ReadAll(rule)
+	if err != nil {
+		return report, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	rules, err := parseRules(contents)
+	if err != nil {
+		return report, fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	correlations, err := parseCorrelations(contents)
+	if err != nil {
+		return report, fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	if len(rules) == 0 && len(correlations) == 0 {
+		return report, fmt.Errorf("%s doesn't contain a Sigma rule", name)
+	}
+
+	r.listings = newDirListings()
+	err = r.addResults(&report, r.testRules(name, []string{testsPath}, rules, correlations))
+	return report, err
+}
+
+// MatchesRulePattern checks whether a file could contain rules (or test cases) based on its name
+func (r *Runner) MatchesRulePattern(path string) bool {
+	patterns := r.RulePatterns
+	if len(patterns) == 0 {
+		patterns = []string{"*.yaml", "*.yml"}
+	}
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) testSuffix() string {
+	if r.TestSuffix == "" {
+		return "_test"
+	}
+	return r.TestSuffix
+}
+
+// TestFilename returns the path of the test file for the rule file at path.
+// Test files can use either of the .yaml and .yml extensions regardless of the rule's: if neither exists then the path with the rule's extension is returned.
+func (r *Runner) TestFilename(path string) string {
+	candidates := r.testFileCandidates(path)
+	for _, candidate := range candidates {
+		if r.listings.exists(candidate) {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// testFileCandidates returns the paths the rule file at path's test file could have (using the rule's extension first)
+func (r *Runner) testFileCandidates(path string) []string {
+	ext := filepath.Ext(path)
+	var candidates []string
+	for _, testExt := range yamlExtensions(ext) {
+		testFile := strings.TrimSuffix(path, ext) + r.testSuffix() + testExt
+		if rel, ok := relativeTo(r.rulesDir(), testFile); ok && r.TestDir != "" {
+			testFile = filepath.Join(r.TestDir, rel)
+		}
+		candidates = append(candidates, testFile)
+	}
+	return candidates
+}
+
+// yamlExtensions returns the extensions to try for a file with the extension ext
+// (both .yaml and .yml for YAML files, starting with ext itself)
+func yamlExtensions(ext string) []string {
+	switch ext {
+	case ".yaml":
+		return []string{".yaml", ".yml"}
+	case ".yml":
+		return []string{".yml", ".yaml"}
+	default:
+		return []string{ext}
+	}
+}
+
+// TestFilenames returns the paths of all the test files for the rule file at path which exist.
+// As well as TestFilename(path), a rule's test cases can be split across additional test files with names starting with the rule's
+// (e.g. x_negative_test.yaml for x.yaml) but those which are the test file of another rule (e.g. x_y_test.yaml when x_y.yaml exists) aren't included.
+func (r *Runner) TestFilenames(path string) []string {
+	var testFiles []string
+	candidates := r.testFileCandidates(path)
+	for _, candidate := range candidates {
+		if r.listings.exists(candidate) {
+			testFiles = append(testFiles, candidate)
+		}
+	}
+
+	primary := candidates[0]
+	ext := filepath.Ext(primary)
+	prefix := filepath.Base(strings.TrimSuffix(primary, r.testSuffix()+ext)) + "_"
+	for _, name := range r.listings.list(filepath.Dir(primary)) {
+		for _, testExt := range yamlExtensions(ext) {
+			suffix := r.testSuffix() + testExt
+			if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+				continue
+			}
+			additional := filepath.Join(filepath.Dir(primary), name)
+			if samePath(r.RuleFilename(additional), path) {
+				testFiles = append(testFiles, additional)
+			}
+		}
+	}
+	return testFiles
+}
+
+// RefreshListings discards the directory listings cached by the last run so that files created since (e.g. while watching) are found by RuleFilename
+func (r *Runner) RefreshListings() {
+	r.listings = newDirListings()
+}
+
+// RuleFilename returns the path of the rule file which the test file at path is for (other files are returned unchanged).
+// Additional test files (see TestFilenames) are for the existing rule with the longest name which their name starts with,
+// and either of the .yaml and .yml extensions is used for the rule if only one of them exists.
+func (r *Runner) RuleFilename(path string) string {
+	if !r.isTestFile(path) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(strings.TrimSuffix(path, ext), r.testSuffix())
+	for candidate := name; ; {
+		for _, ruleExt := range yamlExtensions(ext) {
+			if rule := r.ruleFilename(candidate + ruleExt); r.listings.exists(rule) {
+				return rule
+			}
+		}
+		base := filepath.Base(candidate)
+		i := strings.LastIndex(base, "_")
+		if i <= 0 {
+			break
+		}
+		candidate = candidate[:len(candidate)-len(base)+i]
+	}
+	return r.ruleFilename(name + ext)
+}
+
+// ruleFilename maps a path in TestDir to the same path in RulesDir
+func (r *Runner) ruleFilename(path string) string {
+	if r.TestDir == "" {
+		return path
+	}
+	if rel, ok := relativeTo(r.TestDir, path); ok {
+		return filepath.Join(r.rulesDir(), rel)
+	}
+	return path
+}
+
+// samePath compares absolute paths so that e.g. "rules/foo.yaml" and "./rules/foo.yaml" are the same file
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func (r *Runner) rulesDir() string {
+	if r.RulesDir == "" {
+		return "."
+	}
+	return r.RulesDir
+}
+
+// relativeTo returns the path relative to dir (if it's inside dir)
+func relativeTo(dir, path string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func (r *Runner) isTestFile(path string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), r.testSuffix())
+}
+
+// testPath tests every rule in a file
+func (r *Runner) testPath(path string) ([]RuleResult, error) {
+	testsPaths := r.testFilenames(path)
+	rules, correlations, err := r.Cache.readRules(path)
+	// Test files for malformed rules assert that they fail to parse rather than containing test cases
+	if suite, suiteErr := r.readTests(testsPaths); suiteErr == nil && suite.ExpectParseError {
+		if err == nil && len(rules) == 0 && len(correlations) == 0 {
+			// Files which aren't recognised as rules at all (e.g. invalid YAML) are rejected too
+			err = fmt.Errorf("not a rule")
+		}
+		return []RuleResult{r.testParseError(path, suite, err)}, nil
+	}
+	if err != nil {
+		// The file is reported as an error rather than stopping the run so that one broken rule doesn't hide the results of the others
+		result := RuleResult{Path: path}
+		r.setStatus(&result, err)
+		result.Fatal = true
+		return []RuleResult{result}, nil
+	}
+	if len(rules) == 0 && len(correlations) == 0 {
+		r.log().Debug("skipping file", "path", path, "reason", "doesn't contain any rules")
+	}
+	return r.testRules(path, testsPaths, rules, correlations), nil
+}
+
+// testParseError checks that a rule file whose test file has expect_parse_error failed to parse (with parseErr)
+func (r *Runner) testParseError(path string, suite testSuite, parseErr error) RuleResult {
+	result := RuleResult{Path: path}
+	if len(suite.Cases) > 0 {
+		r.setStatus(&result, fmt.Errorf("a test file with expect_parse_error can't contain test cases"))
+		return result
+	}
+
+	testCase := CaseResult{Name: "expect_parse_error", Passed: parseErr != nil}
+	if testCase.Passed {
+		r.log().Debug("rule failed to parse as expected", "path", path, "error", parseErr)
+	} else {
+		testCase.Reason = "expected the rule to fail to parse but it parsed successfully"
+	}
+	result.Cases = []CaseResult{testCase}
+	if len(result.Failures()) > 0 {
+		r.setStatus(&result, errFailedTests)
+	} else {
+		r.setStatus(&result, nil)
+	}
+	if r.Fingerprint {
+		result.Fingerprint = fingerprint(result)
+	}
+	return result
+}
+
+// testFilenames is TestFilenames but falls back to TestFilename when there aren't any test files (so that it can be reported as missing)
+func (r *Runner) testFilenames(path string) []string {
+	if testFiles := r.TestFilenames(path); len(testFiles) > 0 {
+		return testFiles
+	}
+	return []string{r.TestFilename(path)}
+}
+
+// readTests loads the test cases in each of testsPaths, concatenating them into a single suite.
+// Placeholders declared in later files take precedence but only one of the files may declare a config.
+func (r *Runner) readTests(testsPaths []string) (testSuite, error) {
+	var merged testSuite
+	for i, path := range testsPaths {
+		suite, err := r.Cache.readTestCases(path)
+		if err == nil && suite.Config != nil && merged.Config != nil {
+			err = fmt.Errorf("only one test file can declare a config")
+		}
+		if err == nil && r.StrictTestFiles {
+			err = checkUnknownFields(path)
+		}
+		if err != nil {
+			if i > 0 {
+				return testSuite{}, fmt.Errorf("%s: %w", path, err)
+			}
+			return testSuite{}, err
+		}
+		r.log().Debug("loaded test cases", "path", path, "cases", len(suite.Cases))
+		merged.Cases = append(merged.Cases, suite.Cases...)
+		merged.Placeholders = mergePlaceholders(merged.Placeholders, suite.Placeholders)
+		if suite.Config != nil {
+			merged.Config = suite.Config
+		}
+		merged.ExpectParseError = merged.ExpectParseError || suite.ExpectParseError
+	}
+	return merged, nil
+}
+
+// testRules tests the rules parsed from the file at path using the test cases in testsPaths
+func (r *Runner) testRules(path string, testsPaths []string, rules []sigma.Rule, correlations []correlationRule) []RuleResult {
+	// If the file contains correlation rules then the test cases are for those
+	// (the rules they correlate are tested as part of them)
+	var results []RuleResult
+	for i, correlation := range correlations {
+		if !r.Filter.Selected(sigma.Rule{Title: correlation.Title, ID: correlation.ID, Tags: correlation.Tags}) {
+			r.log().Debug("skipping rule", "path", path, "title", correlation.Title, "reason", "not selected by the filter")
+			continue
+		}
+		result := RuleResult{
+			Path:  path,
+			Title: correlation.Title,
+			ID:    correlation.ID,
+		}
+		if len(correlations) > 1 {
+			result.Rule = correlation.ID
+			if result.Rule == "" {
+				result.Rule = fmt.Sprintf("correlation #%d", i+1)
+			}
+		}
+		r.setStatus(&result, r.testCorrelation(path, testsPaths, correlation, rules, &result))
+		if r.Fingerprint {
+			result.Fingerprint = fingerprint(result)
+		}
+		results = append(results, result)
+	}
+	if len(correlations) > 0 {
+		return results
+	}
+
+	for i, rule := range rules {
+		if !r.Filter.Selected(rule) {
+			r.log().Debug("skipping rule", "path", path, "title", rule.Title, "reason", "not selected by the filter")
+			continue
+		}
+
+		result := RuleResult{
+			Path:  path,
+			Title: rule.Title,
+			ID:    rule.ID,
+		}
+		// Rules in a collection share a file so need to be distinguished by their ID (or position if they don't have one)
+		if len(rules) > 1 {
+			result.Rule = rule.ID
+			if result.Rule == "" {
+				result.Rule = fmt.Sprintf("#%d", i+1)
+			}
+		}
+
+		r.setStatus(&result, r.testFile(testsPaths, rule, &result))
+		if r.Fingerprint {
+			result.Fingerprint = fingerprint(result)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// setStatus sets the status of a result based on the error returned from testing it
+func (r *Runner) setStatus(result *RuleResult, err error) {
+	defer func() { r.log().Info("tested rule", "rule", result.Name(), "status", result.Status) }()
+	switch {
+	case err == nil && r.WarningsAsErrors && len(result.Warnings) > 0:
+		result.Status = StatusError
+		result.Error = fmt.Sprintf("%d warnings treated as errors", len(result.Warnings))
+		result.Fatal = true
+	case err == nil:
+		result.Status = StatusPass
+	case errors.Is(err, errFailedTests):
+		result.Status = StatusFail
+		result.Fatal = true
+	case errors.Is(err, errEvaluationFailed):
+		result.Status = StatusError
+		result.Error = err.Error()
+		result.Fatal = true
+	case errors.Is(err, errNoLogSources) && r.AllowUnconfigured:
+		r.log().Warn("no config matches the rule's logsource", "rule", result.Name())
+		result.Status = StatusUnconfigured
+	case errors.Is(err, errNoLogSources):
+		result.Status = StatusError
+		result.Error = err.Error()
+		result.Fatal = true
+	case errors.Is(err, errNoTests) && r.RequireTests:
+		result.Status = StatusUntested
+		result.Fatal = true
+	case errors.Is(err, errNoTests):
+		result.Status = StatusSkip
+	default:
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+}
+
+// configsFor returns the configs to evaluate a rule with and whether any of them apply to its logsource.
+// Unless unconfigured rules are being checked for, a rule which no config applies to is evaluated with every config.
+func (r *Runner) configsFor(rule sigma.Rule) ([]sigma.Config, bool) {
+	relevant := relevantConfigs(rule, r.Configs)
+	if len(r.Configs) == 0 || len(relevant) > 0 {
+		return relevant, true
+	}
+	if r.CheckConfigured || r.AllowUnconfigured {
+		return nil, false
+	}
+	r.log().Debug("no config matches the rule's logsource so applying them all", "title", rule.Title)
+	return r.Configs, true
+}
+
+// relevantConfigs returns the configs which apply to a rule based on its logsource.
+// Configs are considered in order so that logsource rewrites from one config are matched by later ones.
+// Configs without any logsources (e.g. only containing field mappings) or with a default index apply to every rule.
+func relevantConfigs(rule sigma.Rule, configs []sigma.Config) []sigma.Config {
+	logsource := rule.Logsource
+	var relevant []sigma.Config
+	for _, config := range configs {
+		matched := len(config.Logsources) == 0 || config.DefaultIndex != ""
+
+		var names []string
+		for name := range config.Logsources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			mapping := config.Logsources[name]
+			if !LogsourceMatches(mapping.Logsource, logsource) {
+				continue
+			}
+			matched = true
+			if mapping.Rewrite.Category != "" {
+				logsource.Category = mapping.Rewrite.Category
+			}
+			if mapping.Rewrite.Product != "" {
+				logsource.Product = mapping.Rewrite.Product
+			}
+			if mapping.Rewrite.Service != "" {
+				logsource.Service = mapping.Rewrite.Service
+			}
+		}
+		if matched {
+			relevant = append(relevant, config)
+		}
+	}
+	return relevant
+}
+
+// excludedConfigWarnings warns about excluded configs with a logsource matching the rule
+// (configs without logsources apply to every rule so aren't warned about)
+func excludedConfigWarnings(rule sigma.Rule, excluded []sigma.Config) []string {
+	var warnings []string
+	for _, config := range excluded {
+		for _, mapping := range config.Logsources {
+			if LogsourceMatches(mapping.Logsource, rule.Logsource) {
+				warnings = append(warnings, fmt.Sprintf("config %q matches the rule's logsource but was excluded as its backends (%s) don't include this one", config.Title, strings.Join(config.Backends, ", ")))
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// LogsourceMatches checks whether a config's logsource mapping applies to a logsource (unset fields in the mapping match anything)
+func LogsourceMatches(mapping sigma.Logsource, logsource sigma.Logsource) bool {
+	switch {
+	case mapping.Category != "" && mapping.Category != logsource.Category:
+		return false
+	case mapping.Product != "" && mapping.Product != logsource.Product:
+		return false
+	case mapping.Service != "" && mapping.Service != logsource.Service:
+		return false
+	default:
+		return true
+	}
+}
+
+var (
+	errNoTests     = fmt.Errorf("SKIP")
+	errFailedTests = fmt.Errorf("FAIL")
+	// errNoLogSources means configs were supplied but none of them apply to the rule's logsource
+	errNoLogSources = fmt.Errorf("no config matches the rule's logsource")
+	// errEvaluationFailed means the rule itself is broken (rather than just not matching as expected)
+	errEvaluationFailed = fmt.Errorf("ERROR")
+)
+
+// testFile runs the test cases for a rule, recording the outcome of each in result
+func (r *Runner) testFile(testsPaths []string, rule sigma.Rule, result *RuleResult) error {
+	if err := checkConditions(rule); err != nil {
+		return err
+	}
+	if err := checkRegexes(rule); err != nil {
+		return err
+	}
+	if err := checkComparisons(rule); err != nil {
+		return err
+	}
+	if r.CheckLevels {
+		if err := checkLevel(rule); err != nil {
+			return err
+		}
+	}
+	suite, err := r.readTests(testsPaths)
+	if err != nil {
+		return err
+	}
+	testCases := suite.Cases
+	if len(testCases) == 0 {
+		return errNoTests
+	}
+
+	relevant, configured := r.configsFor(rule)
+	// The test file's own config is applied regardless of the rule's logsource but doesn't stop a rule from being unconfigured
+	if suite.Config != nil {
+		relevant = append(relevant, *suite.Config)
+	}
+	r.log().Debug("selected configs", "title", rule.Title, "configs", configTitles(relevant))
+	result.configs = relevant
+	if r.Verbose {
+		result.Warnings = append(result.Warnings, excludedConfigWarnings(rule, r.ExcludedConfigs)...)
+	}
+	if r.ShowMappings {
+		result.Mappings = describeMappings(rule, relevant)
+	}
+	if !configured {
+		return errNoLogSources
+	}
+
+	preprocessed := r.preprocessCases(testCases)
+	if r.Coverage {
+		result.Coverage = calculateCoverage(rule, relevant, preprocessed)
+	}
+	if r.CheckEventFields {
+		result.Warnings = append(result.Warnings, unusedEventFields(rule, relevant, preprocessed)...)
+	}
+	if r.StrictTypes {
+		result.Warnings = append(result.Warnings, typeMismatches(rule, relevant, preprocessed)...)
+	}
+
+	if r.CaseInsensitiveFields {
+		// Only evaluation sees the lowercased field names (coverage and warnings use them as they were written)
+		rule, relevant = lowercaseFields(rule), lowercaseConfigs(relevant)
+	}
+
+	placeholders := mergePlaceholders(r.Placeholders, suite.Placeholders)
+	fileExpander := evaluator.WithPlaceholderExpander(placeholderExpander(placeholders, nil))
+	// The rule is only rewritten for evaluation so that everything else sees the rule as it was written
+	expanded := expandModifiers(rule)
+	fileRule := evaluator.ForRule(expanded, evaluator.WithConfig(relevant...), fileExpander)
+	aggregated := hasAggregation(rule)
+	pass, evaluated := true, true
+
+	var benchmarked []benchmarkCase
+	if r.Benchmark > 0 && !aggregated {
+		// Deferred before the timing below so that it runs afterwards (and isn't counted in the rule's duration)
+		defer func() {
+			if evaluated {
+				result.Benchmark = r.benchmark(benchmarked)
+			}
+		}()
+	}
+	defer func(start time.Time) { result.Duration = time.Since(start) }(time.Now())
+	for i, tc := range testCases {
+		c := CaseResult{Index: i, Name: tc.Name, Event: tc.Event, Message: tc.Message, Passed: true}
+		shouldMatch := tc.SuppressedBy == "" // by default, test cases match (unless they're suppressed)
+		if tc.Match != nil {
+			shouldMatch = *tc.Match
+		}
+		caseRule, expander := fileRule, fileExpander
+		if tc.Placeholders != nil {
+			expander = evaluator.WithPlaceholderExpander(placeholderExpander(placeholders, tc.Placeholders))
+			caseRule = evaluator.ForRule(expanded, evaluator.WithConfig(relevant...), expander)
+		}
+		// Aggregations are evaluated over the events of each test case in turn
+		if aggregated {
+			options := append([]evaluator.Option{evaluator.WithConfig(relevant...), expander}, aggregationOptions()...)
+			caseRule = evaluator.ForRule(expanded, options...)
+		}
+		// A test case with several events matches if any of them do
+		events := tc.events()
+		if err := checkMessage(rule, tc); err != nil {
+			evaluated = false
+			c.Passed = false
+			c.Reason = fmt.Sprintf("error evaluating %s: %v", tc.describe(), err)
+			c.Error = err.Error()
+			result.Cases = append(result.Cases, c)
+			continue
+		}
+		prepared := r.preprocess(events)
+		if r.CaseInsensitiveFields {
+			prepared = lowercaseKeys(prepared)
+		}
+		marked := prepareEvents(rule, relevant, prepared)
+		match, index, err := r.matchesAny(caseRule, marked)
+		if tc.ExpectError {
+			if err == nil {
+				pass = false
+				c.Passed = false
+				c.Reason = fmt.Sprintf("%s should have failed to evaluate", tc.describe()) + tc.explainedReason()
+			}
+			result.Cases = append(result.Cases, c)
+			continue
+		}
+		benchmarked = append(benchmarked, benchmarkCase{caseRule, marked})
+		described, explained := tc.describe(), marked[0]
+		if index >= 0 {
+			c.Event, explained = events[index], marked[index]
+			if tc.Events != nil {
+				described = fmt.Sprintf("event %d of %s", index+1, tc.describe())
+			}
+		}
+		if err != nil {
+			evaluated = false
+			c.Passed = false
+			c.Reason = fmt.Sprintf("error evaluating %s: %v", described, err)
+			c.Error = err.Error()
+			result.Cases = append(result.Cases, c)
+			continue
+		}
+
+		if tc.Expect == expectUnknown {
+			c.Observed = "didn't match"
+			if match.Match {
+				c.Observed = "matched"
+			}
+			result.Cases = append(result.Cases, c)
+			continue
+		}
+		switch {
+		case shouldMatch && !match.Match && tc.Events != nil:
+			c.Reason = fmt.Sprintf("none of the %d events in %s matched", len(events), described)
+		case shouldMatch && !match.Match:
+			c.Reason = fmt.Sprintf("%s should have matched", described)
+		case !shouldMatch && match.Match:
+			c.Reason = fmt.Sprintf("%s shouldn't have matched", described)
+		case tc.MatchedSelections != nil:
+			c.Reason = compareSelections(tc, match.SearchResults)
+		}
+		if c.Reason == "" && tc.SuppressedBy != "" {
+			c.Reason = checkSuppressed(rule, tc, match.SearchResults)
+		}
+		if c.Reason != "" {
+			pass = false
+			c.Passed = false
+			c.Reason += tc.explainedReason()
+			if r.Verbose {
+				c.SearchResults = match.SearchResults
+			}
+			if r.Explain {
+				c.Explanation = r.explain(expanded, relevant, expander, explained)
+			}
+		}
+		result.Cases = append(result.Cases, c)
+	}
+	switch {
+	case !evaluated:
+		return errEvaluationFailed
+	case !pass:
+		return errFailedTests
+	default:
+		return nil
+	}
+}
+
+// matches evaluates a rule against an event, giving up if it takes longer than the Timeout.
+// The evaluator doesn't stop when its context is cancelled so a runaway evaluation is abandoned rather than stopped.
+func (r *Runner) matches(rule *evaluator.RuleEvaluator, event map[string]interface{}) (evaluator.Result, error) {
+	if r.Timeout <= 0 {
+		return rule.Matches(context.Background(), event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		result evaluator.Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := rule.Matches(ctx, event)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return evaluator.Result{}, fmt.Errorf("evaluation timed out after %v", r.Timeout)
+	}
+}
+
+// matchesAny evaluates the events in order until one matches (or fails to evaluate),
+// returning the index of that event (or -1 if none of them match)
+func (r *Runner) matchesAny(rule *evaluator.RuleEvaluator, events []map[string]interface{}) (evaluator.Result, int, error) {
+	var result evaluator.Result
+	for i, event := range events {
+		var err error
+		result, err = r.matches(rule, event)
+		if err != nil || result.Match {
+			return result, i, err
+		}
+	}
+	return result, -1, nil
+}
+
+// placeholderExpander resolves placeholders using the values declared by a test case,
+// falling back to those declared for the whole test file
+func placeholderExpander(fileValues, caseValues map[string][]string) func(ctx context.Context, placeholderName string) ([]string, error) {
+	return func(ctx context.Context, placeholderName string) ([]string, error) {
+		// The evaluator passes placeholders in their %name% form
+		name := strings.Trim(placeholderName, "%")
+		if values, ok := caseValues[name]; ok {
+			return values, nil
+		}
+		if values, ok := fileValues[name]; ok {
+			return values, nil
+		}
+		return nil, fmt.Errorf("no values supplied for placeholder %s (checked the test case's placeholders then the test file's and any global ones)", placeholderName)
+	}
+}
+
+// mergePlaceholders combines the global placeholder values with those declared by a test file (which take precedence)
+func mergePlaceholders(global, file map[string][]string) map[string][]string {
+	if len(global) == 0 {
+		return file
+	}
+	merged := map[string][]string{}
+	for name, values := range global {
+		merged[name] = values
+	}
+	for name, values := range file {
+		merged[name] = values
+	}
+	return merged
+}
+
+// checkSuppressed checks that the search named by the test case's suppressed_by is why the rule didn't match the event,
+// i.e. that it matched and that the rule would have matched without it (otherwise the filter wasn't really being tested)
+func checkSuppressed(rule sigma.Rule, tc TestCase, searchResults map[string]bool) string {
+	if _, ok := rule.Detection.Searches[tc.SuppressedBy]; !ok {
+		return fmt.Sprintf("%s is suppressed_by %s which isn't a search in the rule's detection", tc.describe(), tc.SuppressedBy)
+	}
+	if !searchResults[tc.SuppressedBy] {
+		return fmt.Sprintf("%s should have been suppressed by %s but it didn't match", tc.describe(), tc.SuppressedBy)
+	}
+	unsuppressed := make(map[string]bool, len(searchResults))
+	for name, matched := range searchResults {
+		unsuppressed[name] = matched && name != tc.SuppressedBy
+	}
+	for _, condition := range rule.Detection.Conditions {
+		if conditionMatches(condition.Search, rule.Detection.Searches, unsuppressed) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s should have been suppressed by %s but wouldn't have matched without it either", tc.describe(), tc.SuppressedBy)
+}
+
+// compareSelections checks that exactly the expected selections matched the event, returning a description of any differences
+func compareSelections(tc TestCase, searchResults map[string]bool) string {
+	expected := map[string]bool{}
+	for _, selection := range tc.MatchedSelections {
+		expected[selection] = true
+	}
+
+	var matched, missing, unexpected []string
+	for _, selection := range sortedKeys(searchResults) {
+		if searchResults[selection] {
+			matched = append(matched, selection)
+			if !expected[selection] {
+				unexpected = append(unexpected, selection)
+			}
+		}
+	}
+	for _, selection := range sortedKeys(expected) {
+		if !searchResults[selection] {
+			missing = append(missing, selection)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return ""
+	}
+
+	reason := fmt.Sprintf("%s matched selections [%s] but expected [%s]", tc.describe(), strings.Join(matched, ", "), strings.Join(sortedKeys(expected), ", "))
+	if len(missing) > 0 {
+		reason += fmt.Sprintf("; missing: %s", strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		reason += fmt.Sprintf("; unexpected: %s", strings.Join(unexpected, ", "))
+	}
+	return reason
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
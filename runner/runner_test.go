@@ -0,0 +1,1888 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-go/evaluator"
+)
+
+// writeRule writes a rule and its test cases to a temporary directory, returning the rule's path
+func writeRule(t *testing.T, rule, tests string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rule.yaml")
+	if err := os.WriteFile(path, []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rule_test.yaml"), []byte(tests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEvaluationErrors(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a|unknownmodifier: foo
+  condition: selection
+`, `
+match: false
+event:
+  a: foo
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError {
+		t.Fatalf("expected a single ERROR result, got %+v", results)
+	}
+	if len(results[0].Failures()) != 1 || results[0].Failures()[0].Error == "" {
+		t.Fatalf("expected the evaluation error to be reported, got %+v", results[0].Failures())
+	}
+}
+
+func TestExpectError(t *testing.T) {
+	tests := `
+expect_error: true
+event:
+  a: foo
+`
+	path := writeRule(t, `
+detection:
+  selection:
+    a|unknownmodifier: foo
+  condition: selection
+`, tests)
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass {
+		t.Fatalf("expected the evaluation error to pass the test case, got %+v", results)
+	}
+
+	path = writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, tests)
+	results, err = (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Fatalf("expected a rule which evaluates cleanly to fail the test case, got %+v", results)
+	}
+	if failures := results[0].Failures(); len(failures) != 1 || !strings.Contains(failures[0].Reason, "should have failed to evaluate") {
+		t.Fatalf("expected the failure to say the rule should have failed to evaluate, got %+v", failures)
+	}
+}
+
+func TestExpectParseError(t *testing.T) {
+	invalid := `
+detection:
+  selection:
+    a: foo
+  condition: selection and
+`
+	for _, rule := range []string{invalid, "detection: [\n"} {
+		path := writeRule(t, rule, "expect_parse_error: true\n")
+		results, err := (&Runner{}).testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != StatusPass {
+			t.Fatalf("expected the parse error to pass, got %+v", results)
+		}
+	}
+
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, "expect_parse_error: true\n")
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Fatalf("expected a rule which parses to fail, got %+v", results)
+	}
+	if failures := results[0].Failures(); len(failures) != 1 || !strings.Contains(failures[0].Reason, "parsed successfully") {
+		t.Fatalf("expected the failure to say the rule parsed successfully, got %+v", failures)
+	}
+
+	// Without expect_parse_error, a parse error is reported as an error
+	path = writeRule(t, invalid, "event:\n  a: foo\n")
+	results, err = (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError || !results[0].Fatal {
+		t.Fatalf("expected a rule which fails to parse to error, got %+v", results)
+	}
+}
+
+func TestFailureOrder(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+name: zulu
+event:
+  a: bar
+---
+event:
+  a: foo
+---
+name: yankee
+match: false
+event:
+  a: foo
+---
+testcases:
+  dont-match:
+    - a: foo
+    - a: bar
+  match:
+    - a: baz
+---
+name: xray
+event:
+  a: baz
+`)
+	results, err := (&Runner{Jobs: 4}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failures []string
+	for _, failure := range results[0].Failures() {
+		failures = append(failures, fmt.Sprintf("%d %s", failure.Index, failure.DisplayName()))
+	}
+	// Failures are in file order rather than e.g. sorted by name or grouped by match/dont-match
+	expected := []string{"0 zulu", "2 yankee", "3 case 4", "5 case 6", "6 xray"}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Fatalf("expected failures %v, got %v", expected, failures)
+	}
+}
+
+func TestNumericComparisons(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    EventID|gte: 4624
+  condition: selection
+`, `
+event:
+  winlog:
+    event_id: 4624
+---
+match: false
+event:
+  winlog:
+    event_id: "4623"
+`)
+	configs := []sigma.Config{{FieldMappings: map[string]sigma.FieldMapping{"EventID": {TargetNames: []string{"$.winlog.event_id"}}}}}
+	results, err := (&Runner{Configs: configs}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass {
+		t.Fatalf("expected the comparison to use the mapped field, got %+v", results)
+	}
+
+	path = writeRule(t, `
+detection:
+  selection:
+    EventID|gte: lots
+  condition: selection
+`, `
+event:
+  EventID: 4624
+`)
+	results, err = (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError || !strings.Contains(results[0].Error, `invalid number "lots"`) {
+		t.Fatalf("expected a comparison with a value which isn't a number to error, got %+v", results)
+	}
+}
+
+func TestUnknownExpectation(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+match: maybe
+event:
+  a: foo
+---
+expect: unknown
+event:
+  a: bar
+---
+event:
+  a: foo
+`)
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass {
+		t.Fatalf("expected test cases with an unknown expectation to pass, got %+v", results)
+	}
+	var observed []string
+	for _, c := range results[0].Unknown() {
+		observed = append(observed, fmt.Sprintf("%d %s", c.Index, c.Observed))
+	}
+	expected := []string{"0 matched", "1 didn't match"}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Fatalf("expected the observed outcomes %v, got %v", expected, observed)
+	}
+
+	for _, tests := range []string{"expect: unknown\nmatch: true\nevent:\n  a: foo\n", "expect: sometimes\nevent:\n  a: foo\n"} {
+		path := writeRule(t, "detection:\n  selection:\n    a: foo\n  condition: selection\n", tests)
+		results, err := (&Runner{}).testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != StatusError {
+			t.Fatalf("expected %q to be an error, got %+v", tests, results)
+		}
+	}
+}
+
+func TestSuppressedBy(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    dst_port: 22
+  filter:
+    user: alice
+  condition: selection and not filter
+`, `
+name: suppressed
+suppressed_by: filter
+event:
+  dst_port: 22
+  user: alice
+---
+name: selection didn't match
+suppressed_by: filter
+event:
+  dst_port: 443
+  user: alice
+---
+name: filter didn't match
+suppressed_by: filter
+match: false
+event:
+  dst_port: 443
+  user: bob
+---
+name: undefined filter
+suppressed_by: filtre
+event:
+  dst_port: 22
+  user: alice
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Fatalf("expected a single failing result, got %+v", results)
+	}
+	expected := map[string]string{
+		"selection didn't match": "wouldn't have matched without it",
+		"filter didn't match":    "but it didn't match",
+		"undefined filter":       "isn't a search in the rule's detection",
+	}
+	failures := results[0].Failures()
+	if len(failures) != len(expected) {
+		t.Fatalf("expected %d failures, got %+v", len(expected), failures)
+	}
+	for _, failure := range failures {
+		if !strings.Contains(failure.Reason, expected[failure.Name]) {
+			t.Errorf("expected the failure of %q to contain %q, got %q", failure.Name, expected[failure.Name], failure.Reason)
+		}
+	}
+}
+
+func TestRepeatedRules(t *testing.T) {
+	path := writeRule(t, `
+title: Shell spawned by a web server
+detection:
+  selection:
+    ParentImage: nginx
+    Image: sh
+  condition: selection
+---
+action: repeat
+detection:
+  selection:
+    Image: bash
+---
+action: repeat
+detection:
+  selection:
+    ParentImage: apache2
+`, `
+event:
+  ParentImage: nginx
+  Image: bash
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, result := range results {
+		statuses[result.Rule] = result.Status
+	}
+	expected := map[string]string{"#1": StatusFail, "#2": StatusPass, "#3": StatusFail}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected each repeated variant to be tested, got %v", statuses)
+	}
+
+	if _, err := parseRules([]byte("action: repeat\ntitle: foo\n---\ntitle: bar\n")); err == nil {
+		t.Fatal("expected an error for a repeat without a previous rule")
+	}
+}
+
+func TestEventJSONConflictsWithEvent(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event:
+  a: foo
+event_json: '{"a": "foo"}'
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError {
+		t.Fatalf("expected a single ERROR result, got %+v", results)
+	}
+}
+
+func TestMissingEventFile(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event_file: missing.json
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError {
+		t.Fatalf("expected a single ERROR result, got %+v", results)
+	}
+}
+
+func TestMatchesTimeout(t *testing.T) {
+	rule, err := sigma.ParseRule([]byte(`
+detection:
+  selection:
+    a: '%slow%'
+  condition: selection
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := evaluator.ForRule(rule, evaluator.WithPlaceholderExpander(func(ctx context.Context, placeholderName string) ([]string, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}))
+
+	r := &Runner{Timeout: 10 * time.Millisecond}
+	if _, err := r.matches(slow, map[string]interface{}{"a": "foo"}); err == nil {
+		t.Fatal("expected evaluation to time out")
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	var streamed []RuleResult
+	r := &Runner{OnResult: func(result RuleResult) error {
+		streamed = append(streamed, result)
+		return nil
+	}}
+	report, err := r.Run([]string{"../testdata/condition-allofthem.yaml", "../testdata/no-tests.yaml", "../testdata/config-test.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed {
+		t.Error("expected the run to fail as config-test.yaml needs a config to pass")
+	}
+	if !reflect.DeepEqual(report.Results, streamed) {
+		t.Errorf("streamed results differ from the report:\n%+v\n%+v", streamed, report.Results)
+	}
+
+	var statuses []string
+	for _, result := range report.Results {
+		statuses = append(statuses, result.Status)
+	}
+	if expected := []string{StatusPass, StatusSkip, StatusFail}; !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected statuses %v, got %v", expected, statuses)
+	}
+
+	allOfThem := report.Results[0]
+	if len(allOfThem.Cases) != 5 || len(allOfThem.Failures()) != 0 || allOfThem.Duration <= 0 {
+		t.Errorf("unexpected result for %s: %+v", allOfThem.Path, allOfThem)
+	}
+	if failures := report.Results[2].Failures(); len(failures) != 1 || failures[0].Index != 0 || failures[0].Passed {
+		t.Errorf("expected the first case of config-test.yaml to fail: %+v", report.Results[2].Cases)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    Image|endswith: '\cmd.exe'
+    CommandLine|contains:
+      - whoami
+      - hostname
+  condition: selection
+`, `
+event:
+  Image: C:\Windows\System32\cmd.exe
+  CommandLine: cmd.exe /c dir
+`)
+
+	results, err := (&Runner{Explain: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := results[0].Failures()
+	if len(failures) != 1 {
+		t.Fatalf("expected a single failure, got %+v", results[0].Cases)
+	}
+	expected := []FieldExplanation{
+		{Search: "selection", Matcher: `Image|endswith: "\\cmd.exe"`, Value: `C:\Windows\System32\cmd.exe`, Matched: true},
+		{Search: "selection", Matcher: `CommandLine|contains: ["whoami", "hostname"]`, Value: "cmd.exe /c dir", Matched: false},
+	}
+	if !reflect.DeepEqual(failures[0].Explanation, expected) {
+		t.Fatalf("expected explanation %+v, got %+v", expected, failures[0].Explanation)
+	}
+}
+
+func TestRulePatterns(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"rule.sigma":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"rule_test.sigma": "event:\n  a: foo\n",
+		"other.yaml":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := (&Runner{RulePatterns: []string{"*.sigma"}}).Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Path != filepath.Join(dir, "rule.sigma") || report.Results[0].Status != StatusPass {
+		t.Fatalf("expected only rule.sigma to be tested, got %+v", report.Results)
+	}
+}
+
+func TestTestFilesAreNotRules(t *testing.T) {
+	dir := t.TempDir()
+	// A test file which happens to also be a valid rule
+	contents := "detection:\n  selection:\n    a: foo\n  condition: selection\nevent:\n  a: foo\n"
+	if err := os.WriteFile(filepath.Join(dir, "orphan_test.yaml"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := (&Runner{AllowEmpty: true}).Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 0 {
+		t.Fatalf("expected the test file to be ignored, got %+v", report.Results)
+	}
+}
+
+func TestNoRulesFound(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a rule\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := (&Runner{}).Run([]string{dir})
+	if err == nil || err.Error() != "no rules found under "+dir {
+		t.Fatalf("expected an error saying no rules were found, got %v", err)
+	}
+	if report.Passed {
+		t.Fatal("expected finding no rules not to pass")
+	}
+
+	if _, err := (&Runner{AllowEmpty: true}).Run([]string{dir}); err != nil {
+		t.Fatalf("expected finding no rules to be allowed, got %v", err)
+	}
+}
+
+func TestDuplicateIDs(t *testing.T) {
+	dir := t.TempDir()
+	rule := "id: 5f1c0a3e-0000-4000-8000-000000000001\ndetection:\n  selection:\n    a: foo\n  condition: selection\n"
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(rule), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := (&Runner{CheckDuplicateIDs: true}).Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"5f1c0a3e-0000-4000-8000-000000000001": {filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")},
+	}
+	if !reflect.DeepEqual(report.DuplicateIDs, expected) {
+		t.Fatalf("expected duplicates %v, got %v", expected, report.DuplicateIDs)
+	}
+	if report.Passed {
+		t.Fatal("expected duplicate IDs to fail the run")
+	}
+}
+
+func TestRequireTests(t *testing.T) {
+	for _, requireTests := range []bool{false, true} {
+		report, err := (&Runner{RequireTests: requireTests}).Run([]string{"../testdata/no-tests.yaml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := StatusSkip
+		if requireTests {
+			expected = StatusUntested
+		}
+		if len(report.Results) != 1 || report.Results[0].Status != expected || report.Passed == requireTests {
+			t.Errorf("RequireTests=%v: expected a single %s result, got %+v", requireTests, expected, report)
+		}
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    user: alice
+  condition: selection
+`, `
+name: admin login
+reason: alice is an administrator
+match: false
+event:
+  user: alice
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := results[0].Failures()
+	expected := `"admin login" shouldn't have matched (reason: alice is an administrator)`
+	if len(failures) != 1 || failures[0].Reason != expected {
+		t.Fatalf("expected failure %q, got %+v", expected, failures)
+	}
+}
+
+func TestRunReader(t *testing.T) {
+	tests := filepath.Join(t.TempDir(), "tests.yaml")
+	if err := os.WriteFile(tests, []byte("match: true\nevent:\n  user: alice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rule := `
+title: Alice
+detection:
+  selection:
+    user: alice
+  condition: selection
+`
+	report, err := (&Runner{}).RunReader("<stdin>", strings.NewReader(rule), tests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed || len(report.Results) != 1 || report.Results[0].Path != "<stdin>" || report.Results[0].Status != StatusPass {
+		t.Fatalf("expected a single passing result, got %+v", report)
+	}
+
+	if _, err := (&Runner{}).RunReader("<stdin>", strings.NewReader("foo: bar\n"), tests); err == nil {
+		t.Fatal("expected an error for input which isn't a rule")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	files, err := (&Runner{}).Discover([]string{"../testdata/events.yaml", "../testdata/no-tests.yaml", "../testdata/config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DiscoveredFile{
+		{Path: "../testdata/events.yaml", Type: sigma.RuleFile, TestFile: "../testdata/events_test.yaml", TestFiles: []string{"../testdata/events_test.yaml"}, TestCases: 2},
+		{Path: "../testdata/no-tests.yaml", Type: sigma.RuleFile},
+		{Path: "../testdata/config.yaml", Type: sigma.ConfigFile},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, files)
+	}
+}
+
+func TestCheckEventFields(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    Image|endswith: '\cmd.exe'
+  condition: selection
+`, `
+name: raw field name
+match: false
+event:
+  Image: C:\Windows\System32\cmd.exe
+---
+name: mapped field name
+event:
+  process.executable: C:\Windows\System32\cmd.exe
+  procces.pid: 4
+`)
+	config := sigma.Config{FieldMappings: map[string]sigma.FieldMapping{
+		"Image": {TargetNames: []string{"process.executable"}},
+	}}
+
+	results, err := (&Runner{Configs: []sigma.Config{config}, CheckEventFields: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != StatusPass {
+		t.Fatalf("expected the rule to pass, got %+v", results[0])
+	}
+	expected := []string{
+		"raw field name: event field Image isn't used by the rule or its configs (configs map it to process.executable)",
+		"mapped field name: event field procces.pid isn't used by the rule or its configs",
+	}
+	if !reflect.DeepEqual(results[0].Warnings, expected) {
+		t.Fatalf("expected warnings %q, got %q", expected, results[0].Warnings)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	order := func(seed int64) []string {
+		report, err := (&Runner{Shuffle: true, Seed: seed}).Run([]string{"../testdata"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, result := range report.Results {
+			paths = append(paths, result.Name())
+		}
+		return paths
+	}
+
+	first, second := order(1), order(1)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("expected the same seed to give the same order, got %q and %q", first, second)
+	}
+	if reflect.DeepEqual(first, order(2)) {
+		t.Fatalf("expected different seeds to give different orders, got %q for both", first)
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    EventID: 4625
+    LogonType: 10
+    CommandLine|contains: '1'
+  condition: selection
+`, `
+name: logon
+event:
+  EventID: "4625"
+  LogonType: 10
+  CommandLine: 1
+`)
+
+	results, err := (&Runner{StrictTypes: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"logon: event field EventID is a string but the rule compares it to a number"}
+	if results[0].Status != StatusPass || !reflect.DeepEqual(results[0].Warnings, expected) {
+		t.Fatalf("expected a passing result with warnings %q, got %+v", expected, results[0])
+	}
+}
+
+func TestRelevantConfigsService(t *testing.T) {
+	windows := sigma.Config{Title: "windows", Logsources: map[string]sigma.LogsourceMapping{
+		"security": {Logsource: sigma.Logsource{Service: "security"}, Rewrite: sigma.Logsource{Service: "windows-security"}},
+	}}
+	rewritten := sigma.Config{Title: "rewritten", Logsources: map[string]sigma.LogsourceMapping{
+		"windows-security": {Logsource: sigma.Logsource{Service: "windows-security"}},
+	}}
+	other := sigma.Config{Title: "other", Logsources: map[string]sigma.LogsourceMapping{
+		"system": {Logsource: sigma.Logsource{Service: "system"}},
+	}}
+
+	rule := sigma.Rule{Logsource: sigma.Logsource{Service: "security"}}
+	var titles []string
+	for _, config := range relevantConfigs(rule, []sigma.Config{windows, rewritten, other}) {
+		titles = append(titles, config.Title)
+	}
+	if expected := []string{"windows", "rewritten"}; !reflect.DeepEqual(titles, expected) {
+		t.Fatalf("expected configs %q to apply to a service-only logsource, got %q", expected, titles)
+	}
+}
+
+func TestRelevantConfigsDeduplicated(t *testing.T) {
+	config := sigma.Config{Title: "windows", Logsources: map[string]sigma.LogsourceMapping{
+		"process_creation": {Logsource: sigma.Logsource{Category: "process_creation"}},
+		"windows":          {Logsource: sigma.Logsource{Product: "windows"}},
+	}}
+
+	rule := sigma.Rule{Logsource: sigma.Logsource{Category: "process_creation", Product: "windows"}}
+	if relevant := relevantConfigs(rule, []sigma.Config{config}); len(relevant) != 1 {
+		t.Fatalf("expected a config with two matching logsources to apply once, got %d configs", len(relevant))
+	}
+}
+
+func TestBase64Offsets(t *testing.T) {
+	expected := []string{"d2hvYW1p", "dob2Fta", "3aG9hbW"}
+	if offsets := base64Offsets("whoami"); !reflect.DeepEqual(offsets, expected) {
+		t.Fatalf("expected %q, got %q", expected, offsets)
+	}
+}
+
+func TestShowMappings(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    Image|endswith: '\cmd.exe'
+    CommandLine|contains: whoami
+  condition: selection
+`, `
+event:
+  process.executable: C:\Windows\System32\cmd.exe
+  CommandLine: whoami
+`)
+	config := sigma.Config{Title: "ecs", FieldMappings: map[string]sigma.FieldMapping{
+		"Image": {TargetNames: []string{"process.executable"}},
+	}}
+
+	results, err := (&Runner{Configs: []sigma.Config{config}, ShowMappings: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Mappings{
+		Configs: []string{"ecs"},
+		Fields:  map[string][]string{"Image": {"process.executable"}, "CommandLine": {"CommandLine"}},
+	}
+	if !reflect.DeepEqual(results[0].Mappings, expected) {
+		t.Fatalf("expected mappings %+v, got %+v", expected, results[0].Mappings)
+	}
+}
+
+func TestGlobalPlaceholders(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    user: '%Administrators%'
+    host: '%Servers%'
+  condition: selection
+`, `
+placeholders:
+  Administrators: [bob]
+---
+event:
+  user: bob
+  host: db1
+---
+match: false
+event:
+  user: alice
+  host: db1
+`)
+
+	r := &Runner{Placeholders: map[string][]string{"Administrators": {"alice"}, "Servers": {"db1"}}}
+	results, err := r.testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != StatusPass {
+		t.Fatalf("expected the test file's placeholders to be merged over the global ones, got %+v", results[0])
+	}
+}
+
+func TestCasePlaceholdersWithoutEvent(t *testing.T) {
+	// Test cases whose event isn't under event still have their own placeholders rather than declaring them for the file
+	path := writeRule(t, `
+detection:
+  selection:
+    user: '%Administrators%'
+  condition: selection
+`, `
+event_json: '{"user": "bob"}'
+placeholders:
+  Administrators: [bob]
+---
+match: false
+event_json: '{"user": "bob"}'
+placeholders:
+  Administrators: [alice]
+`)
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass || len(results[0].Cases) != 2 {
+		t.Fatalf("expected both test cases to be run with their own placeholders, got %+v", results)
+	}
+}
+
+func TestUnconfiguredRules(t *testing.T) {
+	path := writeRule(t, `
+logsource:
+  product: linux
+detection:
+  selection:
+    User: root
+  condition: selection
+`, `
+event:
+  user_name: root
+`)
+	configs := []sigma.Config{{
+		Logsources:    map[string]sigma.LogsourceMapping{"windows": {Logsource: sigma.Logsource{Product: "windows"}}},
+		FieldMappings: map[string]sigma.FieldMapping{"User": {TargetNames: []string{"user_name"}}},
+	}}
+	tests := []struct {
+		runner Runner
+		status string
+		fatal  bool
+	}{
+		// By default a rule which no config applies to is evaluated with every config
+		{Runner{Configs: configs}, StatusPass, false},
+		{Runner{Configs: configs, CheckConfigured: true}, StatusError, true},
+		{Runner{Configs: configs, AllowUnconfigured: true}, StatusUnconfigured, false},
+	}
+	for _, tt := range tests {
+		results, err := tt.runner.testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Status != tt.status || results[0].Fatal != tt.fatal {
+			t.Errorf("expected status %s (fatal %v) with CheckConfigured=%v and AllowUnconfigured=%v, got %+v",
+				tt.status, tt.fatal, tt.runner.CheckConfigured, tt.runner.AllowUnconfigured, results)
+		}
+	}
+}
+
+func TestCorrelationFieldMappings(t *testing.T) {
+	rules := `
+title: Failed login
+name: failed_login
+detection:
+  selection:
+    Outcome: failure
+  condition: selection
+---
+title: Brute force
+correlation:
+  type: event_count
+  rules:
+    - failed_login
+  group-by:
+    - User
+  condition:
+    gte: 2
+---
+title: Password spraying
+correlation:
+  type: value_count
+  rules:
+    - failed_login
+  field: User
+  condition:
+    gte: 2
+`
+	tests := `
+name: failures for one user
+events:
+  - {outcome: failure, user_name: alice}
+  - {outcome: failure, user_name: alice}
+---
+name: failures across users
+match: false
+events:
+  - {outcome: failure, user_name: alice}
+  - {outcome: failure, user_name: bob}
+---
+name: failures without a user
+match: false
+events:
+  - {outcome: failure, user_name: alice}
+  - {outcome: failure}
+`
+	path := writeRule(t, rules, tests)
+	configs := []sigma.Config{{
+		FieldMappings: map[string]sigma.FieldMapping{
+			"User":    {TargetNames: []string{"user_name"}},
+			"Outcome": {TargetNames: []string{"outcome"}},
+		},
+	}}
+	results, err := (&Runner{Configs: configs}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both correlations are tested against the same test cases, which are written for the brute force one
+	outcomes := map[string][]bool{}
+	for _, result := range results {
+		for _, c := range result.Cases {
+			outcomes[result.Title] = append(outcomes[result.Title], c.Passed)
+		}
+	}
+	expected := map[string][]bool{
+		// Events are grouped by the mapped user_name field
+		"Brute force": {true, true, true},
+		// alice and bob are two values but the event without a user doesn't add a value
+		"Password spraying": {false, false, true},
+	}
+	for title, passed := range expected {
+		if !reflect.DeepEqual(outcomes[title], passed) {
+			t.Errorf("%s: expected test cases to pass %v, got %v", title, passed, outcomes[title])
+		}
+	}
+}
+
+func TestCorrelationUnsupportedCondition(t *testing.T) {
+	path := writeRule(t, `
+title: Failed login
+name: failed_login
+detection:
+  selection:
+    outcome: failure
+  condition: selection
+---
+title: Brute force
+correlation:
+  type: event_count
+  rules:
+    - failed_login
+  condition:
+    gte: 1
+    between: 3
+`, `
+events:
+  - {outcome: failure}
+---
+match: false
+events:
+  - {outcome: success}
+`)
+	// The condition is a map so this would depend on its iteration order if the operators weren't validated first
+	for i := 0; i < 20; i++ {
+		results, err := (&Runner{}).testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		correlation := results[len(results)-1]
+		if correlation.Status != StatusError || !strings.Contains(correlation.Error, "unsupported correlation condition between") {
+			t.Fatalf("expected the unsupported operator to be an error, got %s: %s", correlation.Status, correlation.Error)
+		}
+	}
+}
+
+func TestCorrelationUnconfiguredRules(t *testing.T) {
+	path := writeRule(t, `
+title: Failed login
+name: failed_login
+logsource:
+  product: linux
+detection:
+  selection:
+    outcome: failure
+  condition: selection
+---
+title: Brute force
+correlation:
+  type: event_count
+  rules:
+    - failed_login
+  condition:
+    gte: 1
+`, `
+events:
+  - {outcome: failure}
+`)
+	configs := []sigma.Config{{Logsources: map[string]sigma.LogsourceMapping{"windows": {Logsource: sigma.Logsource{Product: "windows"}}}}}
+	tests := []struct {
+		runner Runner
+		status string
+	}{
+		{Runner{Configs: configs}, StatusPass},
+		{Runner{Configs: configs, CheckConfigured: true}, StatusError},
+		{Runner{Configs: configs, AllowUnconfigured: true}, StatusUnconfigured},
+	}
+	for _, tt := range tests {
+		results, err := tt.runner.testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The correlated rule has no test cases of its own so only the correlation is checked
+		correlation := results[len(results)-1]
+		if correlation.Status != tt.status {
+			t.Errorf("expected the correlation to be %s, got %s: %s", tt.status, correlation.Status, correlation.Error)
+		}
+	}
+}
+
+func TestCorrelationUnsupportedAssertions(t *testing.T) {
+	rules := `
+title: Failed login
+name: failed_login
+detection:
+  selection:
+    outcome: failure
+  condition: selection
+---
+title: Brute force
+correlation:
+  type: event_count
+  rules:
+    - failed_login
+  condition:
+    gte: 1
+`
+	// suppressed_by can't be used with events so is tested with a single event
+	tests := map[string]string{
+		"expect_error":       "events:\n  - {outcome: failure}\nexpect_error: true\n",
+		"matched_selections": "events:\n  - {outcome: failure}\nmatched_selections: [selection]\n",
+		"suppressed_by":      "event: {outcome: failure}\nsuppressed_by: selection\n",
+	}
+	for field, tests := range tests {
+		path := writeRule(t, rules, tests)
+		results, err := (&Runner{}).testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		correlation := results[len(results)-1]
+		if correlation.Status != StatusError || !strings.Contains(correlation.Error, field+" isn't supported for correlation rules") {
+			t.Errorf("%s: expected an error, got %s: %s", field, correlation.Status, correlation.Error)
+		}
+	}
+}
+
+func TestFilterLogsource(t *testing.T) {
+	filter := Filter{Logsource: sigma.Logsource{Product: "windows", Category: "process_creation"}}
+	tests := []struct {
+		logsource sigma.Logsource
+		selected  bool
+	}{
+		{sigma.Logsource{Product: "windows", Category: "process_creation"}, true},
+		{sigma.Logsource{Product: "windows", Category: "process_creation", Service: "sysmon"}, true},
+		{sigma.Logsource{Product: "windows", Category: "network_connection"}, false},
+		{sigma.Logsource{Category: "process_creation"}, false},
+	}
+	for _, tt := range tests {
+		if filter.Selected(sigma.Rule{Logsource: tt.logsource}) != tt.selected {
+			t.Errorf("expected Selected(%+v) to be %v", tt.logsource, tt.selected)
+		}
+	}
+}
+
+func TestReportErrored(t *testing.T) {
+	broken := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+match: [not a bool]
+`)
+	report, err := (&Runner{}).Run([]string{broken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Errored {
+		t.Fatalf("expected a test file which can't be parsed to be an error, got %+v", report)
+	}
+
+	report, err = (&Runner{}).Run([]string{"../testdata/config-test.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Errored || report.Passed {
+		t.Fatalf("expected a failing rule to fail the run without erroring, got %+v", report)
+	}
+}
+
+func TestRunContinuesAfterParseError(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a_broken.yaml":     "detection:\n  selection:\n    a: foo\n  condition: selection and\n",
+		"b_valid.yaml":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"b_valid_test.yaml": "event:\n  a: foo\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := (&Runner{}).Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Errored || report.Passed {
+		t.Fatalf("expected the parse error to error the run, got %+v", report)
+	}
+	statuses := map[string]string{}
+	for _, result := range report.Results {
+		statuses[filepath.Base(result.Path)] = result.Status
+	}
+	expected := map[string]string{"a_broken.yaml": StatusError, "b_valid.yaml": StatusPass}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a_fail.yaml":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"a_fail_test.yaml": "event:\n  a: bar\n",
+		"b_fail.yaml":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"b_fail_test.yaml": "event:\n  a: bar\n",
+		"c_pass.yaml":      "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"c_pass_test.yaml": "event:\n  a: foo\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A later path isn't tested either
+	other := writeRule(t, "detection:\n  selection:\n    a: foo\n  condition: selection\n", "event:\n  a: foo\n")
+
+	for _, jobs := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			report, err := (&Runner{FailFast: true, Jobs: jobs}).Run([]string{dir, other})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Passed {
+				t.Fatalf("expected the run to fail, got %+v", report)
+			}
+			if len(report.Results) != 1 || filepath.Base(report.Results[0].Path) != "a_fail.yaml" {
+				t.Fatalf("expected testing to stop after a_fail.yaml, got %+v", report.Results)
+			}
+		})
+	}
+}
+
+func TestUnsupportedAggregation(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    EventID: 4625
+  condition: selection | count(TargetUserName) > 2
+`, `
+events:
+  - EventID: 4625
+    TargetUserName: alice
+`)
+
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := results[0].Failures()
+	if results[0].Status != StatusError || len(failures) != 1 || !strings.Contains(failures[0].Error, "count_distinct") {
+		t.Fatalf("expected an error naming the unsupported aggregation, got %+v", results[0])
+	}
+}
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := &Runner{Logger: slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	if _, err := r.Run([]string{"../testdata/events.yaml", "../testdata/events_test.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`msg="found rule file" path=../testdata/events.yaml`,
+		`msg="skipping file" path=../testdata/events_test.yaml reason="test file"`,
+		`msg="loaded test cases" path=../testdata/events_test.yaml cases=2`,
+		`msg="tested rule" rule=../testdata/events.yaml status=PASS`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected the log to contain %s:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestFilterPaths(t *testing.T) {
+	r := &Runner{Filter: Filter{Paths: []string{"../testdata/events.yaml", "../testdata/placeholders_test.yaml"}}}
+	report, err := r.Run([]string{"../testdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tested []string
+	for _, result := range report.Results {
+		tested = append(tested, result.Path)
+	}
+	// placeholders.yaml is tested because its test file is included
+	expected := []string{"../testdata/events.yaml", "../testdata/placeholders.yaml"}
+	if !reflect.DeepEqual(tested, expected) {
+		t.Fatalf("expected only %v to be tested, got %v", expected, tested)
+	}
+}
+
+func TestSkipsGitAndIgnoredPaths(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{".git", "ignored", "rules"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "rule.yaml"), []byte("detection:\n  condition: foo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{Recursive: true, Filter: Filter{IgnoredPaths: []string{filepath.Join(root, "ignored")}}}
+	paths, err := r.findRules(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "rules", "rule.yaml")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected only %v to be found, got %v", expected, paths)
+	}
+}
+
+func TestFlattenEvent(t *testing.T) {
+	event := map[string]interface{}{
+		"a":   map[string]interface{}{"b": map[string]interface{}{"c": 1}, "d": 2},
+		"a.d": 3,
+	}
+	expected := map[string]interface{}{
+		"a":     event["a"],
+		"a.b":   map[string]interface{}{"c": 1},
+		"a.b.c": 1,
+		"a.d":   3, // keys already in the event take precedence
+	}
+	if flattened := flattenEvent(event); !reflect.DeepEqual(flattened, expected) {
+		t.Fatalf("expected %v, got %v", expected, flattened)
+	}
+	if len(event) != 2 {
+		t.Fatalf("expected the original event to be unchanged, got %v", event)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	r := &Runner{Benchmark: 10 * time.Millisecond}
+	report, err := r.Run([]string{"../testdata/events.yaml", "../testdata/aggregation.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(report.Results))
+	}
+	events, aggregation := report.Results[0], report.Results[1]
+	if events.Benchmark == nil || events.Benchmark.Evaluations == 0 || events.Benchmark.Duration < r.Benchmark {
+		t.Errorf("expected events.yaml to be benchmarked for at least %v, got %+v", r.Benchmark, events.Benchmark)
+	}
+	if events.Duration >= r.Benchmark {
+		t.Errorf("expected the benchmark not to be included in the rule's duration, got %v", events.Duration)
+	}
+	if aggregation.Benchmark != nil {
+		t.Errorf("expected rules with aggregations not to be benchmarked, got %+v", aggregation.Benchmark)
+	}
+}
+
+func TestUndefinedSearch(t *testing.T) {
+	tests := map[string]string{
+		"selection and not filetr":         "condition refers to undefined search filetr",
+		"selection and not 1 of filter*":   "condition refers to undefined search filter*",
+		"selektion or (filetr and foo)":    "condition refers to undefined searches filetr, foo, selektion",
+		"1 of selection* and not 1 of sel": "condition refers to undefined search sel",
+		"selection and not all of them":    "",
+	}
+	for condition, expected := range tests {
+		t.Run(condition, func(t *testing.T) {
+			path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: `+condition+`
+`, `
+event:
+  a: foo
+`)
+			results, err := (&Runner{}).testPath(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Error != expected {
+				t.Fatalf("expected error %q, got %q (status %s)", expected, results[0].Error, results[0].Status)
+			}
+		})
+	}
+}
+
+func TestTestDir(t *testing.T) {
+	root := t.TempDir()
+	r := &Runner{Recursive: true, RulesDir: filepath.Join(root, "rules"), TestDir: filepath.Join(root, "tests")}
+	files := map[string]string{
+		"rules/windows/whoami.yaml":      "detection:\n  selection:\n    Image|endswith: whoami.exe\n  condition: selection\n",
+		"tests/windows/whoami_test.yaml": "event:\n  Image: C:\\Windows\\System32\\whoami.exe\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rule := filepath.Join(root, "rules", "windows", "whoami.yaml")
+	testFile := filepath.Join(root, "tests", "windows", "whoami_test.yaml")
+	if actual := r.TestFilename(rule); actual != testFile {
+		t.Errorf("expected the test file to be %s, got %s", testFile, actual)
+	}
+	if actual := r.RuleFilename(testFile); actual != rule {
+		t.Errorf("expected the rule file to be %s, got %s", rule, actual)
+	}
+	outside := filepath.Join(root, "other", "rule.yaml")
+	if actual := r.TestFilename(outside); actual != filepath.Join(root, "other", "rule_test.yaml") {
+		t.Errorf("expected rules outside RulesDir to have their test file next to them, got %s", actual)
+	}
+
+	report, err := r.Run([]string{filepath.Join(root, "rules")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Status != StatusPass || len(report.Results[0].Cases) != 1 {
+		t.Fatalf("expected the rule to be tested using the test file in the test directory, got %+v", report.Results)
+	}
+}
+
+func TestAdditionalTestFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"x.yaml":               "detection:\n  selection:\n    a: foo\n  condition: selection\n",
+		"x_test.yaml":          "event:\n  a: foo\n",
+		"x_negative_test.yaml": "match: false\nevent:\n  a: bar\n",
+		"x_y.yaml":             "detection:\n  selection:\n    a: bar\n  condition: selection\n",
+		"x_y_test.yaml":        "event:\n  a: bar\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{}
+	expected := []string{filepath.Join(dir, "x_test.yaml"), filepath.Join(dir, "x_negative_test.yaml")}
+	if actual := r.TestFilenames(filepath.Join(dir, "x.yaml")); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the test files to be %v, got %v", expected, actual)
+	}
+	if actual := r.RuleFilename(filepath.Join(dir, "x_negative_test.yaml")); actual != filepath.Join(dir, "x.yaml") {
+		t.Errorf("expected the additional test file to be for x.yaml, got %s", actual)
+	}
+
+	report, err := r.Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{}
+	for _, result := range report.Results {
+		if result.Status != StatusPass {
+			t.Errorf("expected %s to pass, got %+v", result.Path, result)
+		}
+		cases[filepath.Base(result.Path)] = len(result.Cases)
+	}
+	if cases["x.yaml"] != 2 || cases["x_y.yaml"] != 1 {
+		t.Fatalf("expected x.yaml to be tested with both of its test files and x_y.yaml only with its own, got %v", cases)
+	}
+}
+
+func TestTestSuffix(t *testing.T) {
+	// The _test file would fail the rule so shows whether it's used
+	path := writeRule(t, "detection:\n  selection:\n    a: foo\n  condition: selection\n", "match: false\nevent:\n  a: foo\n")
+	dir := filepath.Dir(path)
+	files := map[string]string{
+		"rule.tests.yaml":          "event:\n  a: foo\n",
+		"rule_negative.tests.yaml": "match: false\nevent:\n  a: bar\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{TestSuffix: ".tests"}
+	expected := []string{filepath.Join(dir, "rule.tests.yaml"), filepath.Join(dir, "rule_negative.tests.yaml")}
+	if actual := r.TestFilenames(path); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the test files to be %v, got %v", expected, actual)
+	}
+	for _, name := range []string{"rule.tests.yaml", "rule_negative.tests.yaml"} {
+		if actual := r.RuleFilename(filepath.Join(dir, name)); actual != path {
+			t.Errorf("expected %s to be for %s, got %s", name, path, actual)
+		}
+	}
+
+	report, err := r.Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The .tests files aren't tested as rules but rule_test.yaml is just another file without a rule
+	if len(report.Results) != 1 || report.Results[0].Path != path {
+		t.Fatalf("expected only the rule to be tested, got %+v", report.Results)
+	}
+	if result := report.Results[0]; result.Status != StatusPass || len(result.Cases) != 2 {
+		t.Fatalf("expected the rule to pass with both of its .tests files, got %+v", result)
+	}
+}
+
+func TestTestFileExtensions(t *testing.T) {
+	dir := t.TempDir()
+	rule := "detection:\n  selection:\n    a: foo\n  condition: selection\n"
+	files := map[string]string{
+		"x.yml":               rule,
+		"x_test.yaml":         "event:\n  a: foo\n",
+		"x_negative_test.yml": "match: false\nevent:\n  a: bar\n",
+		"y.yaml":              rule,
+		"y_test.yml":          "event:\n  a: foo\n",
+		"z.yaml":              rule,
+		"z_test.yaml":         "event:\n  a: foo\n",
+		"z_test.yml":          "match: false\nevent:\n  a: bar\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Runner{}
+	if actual := r.TestFilename(filepath.Join(dir, "x.yml")); actual != filepath.Join(dir, "x_test.yaml") {
+		t.Errorf("expected the test file with the other extension to be found, got %s", actual)
+	}
+	if actual := r.RuleFilename(filepath.Join(dir, "y_test.yml")); actual != filepath.Join(dir, "y.yaml") {
+		t.Errorf("expected the rule with the other extension to be found, got %s", actual)
+	}
+
+	report, err := r.Run([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{}
+	for _, result := range report.Results {
+		if result.Status != StatusPass {
+			t.Errorf("expected %s to pass, got %+v", result.Path, result)
+		}
+		cases[filepath.Base(result.Path)] = len(result.Cases)
+	}
+	expected := map[string]int{"x.yml": 2, "y.yaml": 1, "z.yaml": 2}
+	for rule, count := range expected {
+		if cases[rule] != count {
+			t.Errorf("expected %s to have %d test cases, got %d", rule, count, cases[rule])
+		}
+	}
+}
+
+func TestLintTests(t *testing.T) {
+	dir := t.TempDir()
+	rule := "detection:\n  selection:\n    a: foo\n  condition: selection\n"
+	files := map[string]string{
+		"valid.yaml":        rule,
+		"valid_test.yaml":   "anchors:\n  base: &base\n    a: foo\n---\nevent: *base\n---\nmatch: false\nevent: bar\n",
+		"typo.yaml":         rule,
+		"typo_test.yaml":    "event:\n  a: foo\n---\nmacth: false\nevent:\n  a: bar\n",
+		"empty.yaml":        rule,
+		"empty_test.yaml":   "---\n",
+		"invalid.yaml":      rule,
+		"invalid_test.yaml": "event: [\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := (&Runner{}).LintTests([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]string{}
+	for _, problem := range problems {
+		if _, ok := found[filepath.Base(problem.Rule)]; ok {
+			t.Errorf("expected a single problem for %s, got another: %s", problem.Rule, problem.Problem)
+		}
+		found[filepath.Base(problem.Rule)] = problem.Problem
+	}
+	expected := map[string]string{
+		"typo.yaml":    "field macth not found",
+		"empty.yaml":   "doesn't contain any test cases",
+		"invalid.yaml": "error parsing test cases",
+	}
+	if len(found) != len(expected) {
+		t.Errorf("expected problems with %d test files, got %v", len(expected), found)
+	}
+	for rule, problem := range expected {
+		if !strings.Contains(found[rule], problem) {
+			t.Errorf("expected the problem with %s to contain %q, got %q", rule, problem, found[rule])
+		}
+	}
+}
+
+func TestCaseInsensitiveFields(t *testing.T) {
+	path := writeRule(t, `
+logsource:
+  product: windows
+detection:
+  selection:
+    CommandLine|contains: whoami
+    Parent: explorer.exe
+  condition: selection
+`, `
+event:
+  commandline: whoami /all
+  process:
+    parent: explorer.exe
+`)
+	configs := []sigma.Config{{FieldMappings: map[string]sigma.FieldMapping{"Parent": {TargetNames: []string{"Process.Parent"}}}}}
+
+	results, err := (&Runner{Configs: configs}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Fatalf("expected field names to be case-sensitive by default, got %+v", results)
+	}
+
+	results, err = (&Runner{Configs: configs, CaseInsensitiveFields: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass {
+		t.Fatalf("expected the event to match ignoring the case of field names, got %+v", results)
+	}
+	if results[0].Cases[0].Event["commandline"] == nil {
+		t.Fatalf("expected the event to be reported as it was written, got %+v", results[0].Cases[0].Event)
+	}
+}
+
+func TestPreprocess(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    CommandLine|contains: whoami
+    Image: cmd.exe
+  condition: selection
+`, `
+event:
+  vendor:
+    cmd: whoami /all
+  proc_name: cmd.exe
+`)
+
+	r := &Runner{Preprocess: RenameFields(map[string]string{"vendor.cmd": "CommandLine", "proc_name": "Image"})}
+	results, err := r.testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusPass {
+		t.Fatalf("expected the renamed fields to match, got %+v", results)
+	}
+	if _, ok := results[0].Cases[0].Event["proc_name"]; !ok {
+		t.Fatalf("expected the event to be reported as it was written, got %+v", results[0].Cases[0].Event)
+	}
+}
+
+func TestRenameFieldsOrder(t *testing.T) {
+	event := map[string]interface{}{"a": "1", "b": "2", "x": "3", "y": "4"}
+	tests := map[string]struct {
+		renames  map[string]string
+		expected map[string]interface{}
+	}{
+		"chained":   {map[string]string{"a": "b", "b": "c"}, map[string]interface{}{"b": "1", "c": "2", "x": "3", "y": "4"}},
+		"swapped":   {map[string]string{"a": "b", "b": "a"}, map[string]interface{}{"a": "2", "b": "1", "x": "3", "y": "4"}},
+		"same name": {map[string]string{"x": "z", "y": "z"}, map[string]interface{}{"a": "1", "b": "2", "z": "4"}},
+		"missing":   {map[string]string{"missing": "a"}, event},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Map iteration order varies so a result which depended on it would differ between attempts
+			for i := 0; i < 20; i++ {
+				if renamed := RenameFields(tt.renames)(event); !reflect.DeepEqual(renamed, tt.expected) {
+					t.Fatalf("expected %v, got %v", tt.expected, renamed)
+				}
+			}
+		})
+	}
+}
+
+func TestStrictness(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event:
+  a: foo
+  b: unused
+`)
+
+	results, err := (&Runner{CheckEventFields: true, WarningsAsErrors: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError || !results[0].Fatal || len(results[0].Warnings) != 1 {
+		t.Fatalf("expected the warning to be reported as an error, got %+v", results)
+	}
+
+	path = writeRule(t, `
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event:
+  a: foo
+---
+macth: false
+event:
+  a: bar
+`)
+	results, err = (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusFail {
+		t.Fatalf("expected the unknown field to be ignored by default, got %+v", results)
+	}
+	results, err = (&Runner{StrictTestFiles: true}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != StatusError || !strings.Contains(results[0].Error, "field macth not found") {
+		t.Fatalf("expected the unknown field to be reported as an error, got %+v", results)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	path := writeRule(t, `
+id: 2d9b9c3e-4b5a-4c0f-8d3e-1f6e5b7a9c01
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event:
+  a: foo
+`)
+	fingerprint := func(r *Runner) string {
+		t.Helper()
+		results, err := r.testPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected a single result, got %+v", results)
+		}
+		return results[0].Fingerprint
+	}
+
+	first := fingerprint(&Runner{Fingerprint: true})
+	if first == "" || fingerprint(&Runner{Fingerprint: true}) != first {
+		t.Fatalf("expected a stable fingerprint, got %q", first)
+	}
+	configs := []sigma.Config{{Title: "mappings", FieldMappings: map[string]sigma.FieldMapping{"a": {TargetNames: []string{"b"}}}}}
+	if fingerprint(&Runner{Fingerprint: true, Configs: configs}) == first {
+		t.Fatal("expected the fingerprint to change with the configs used")
+	}
+	if fingerprint(&Runner{}) != "" {
+		t.Fatal("expected no fingerprint unless Fingerprint is set")
+	}
+}
+
+func TestCheckLevels(t *testing.T) {
+	tests := map[string]string{
+		"level: high\n":     "",
+		"level: critical\n": "",
+		"level: severe\n":   `rule has invalid level "severe" (expected one of informational, low, medium, high, critical)`,
+		"level: High\n":     `rule has invalid level "High" (expected one of informational, low, medium, high, critical)`,
+		"":                  "rule doesn't have a level (expected one of informational, low, medium, high, critical)",
+	}
+	for level, expected := range tests {
+		t.Run(level, func(t *testing.T) {
+			path := writeRule(t, level+`
+detection:
+  selection:
+    a: foo
+  condition: selection
+`, `
+event:
+  a: foo
+`)
+			results, err := (&Runner{CheckLevels: true}).testPath(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Error != expected {
+				t.Fatalf("expected error %q, got %q (status %s)", expected, results[0].Error, results[0].Status)
+			}
+		})
+	}
+}
+
+func TestOnProgress(t *testing.T) {
+	var progress [][2]int
+	r := &Runner{Jobs: 4, OnProgress: func(tested, total int) {
+		progress = append(progress, [2]int{tested, total})
+	}}
+	if _, err := r.Run([]string{"../testdata/events.yaml", "../testdata/anchors.yaml", "../testdata/no-tests.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][2]int{{1, 3}, {2, 3}, {3, 3}}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Fatalf("expected progress %v, got %v", expected, progress)
+	}
+}
+
+func TestInvalidRegex(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    CommandLine|re: '(?<=cmd)whoami'
+  condition: selection
+`, `
+event:
+  CommandLine: cmdwhoami
+`)
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "invalid regular expression for CommandLine in selection: error parsing regexp: invalid named capture: `(?<=cmd)whoami`"
+	if results[0].Status != StatusError || results[0].Error != expected {
+		t.Fatalf("expected error %q, got %s: %q", expected, results[0].Status, results[0].Error)
+	}
+}
+
+func TestStringEventWithoutKeywords(t *testing.T) {
+	path := writeRule(t, `
+detection:
+  selection:
+    Image: mimikatz.exe
+  condition: selection
+`, `
+event: mimikatz.exe
+`)
+	results, err := (&Runner{}).testPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `error evaluating "mimikatz.exe": the event is a string but the rule doesn't have any keyword searches`
+	if results[0].Status != StatusError || results[0].Cases[0].Reason != expected {
+		t.Fatalf("expected the case to error with %q, got %s: %+v", expected, results[0].Status, results[0].Cases)
+	}
+}
+
+func TestExcludedConfigWarnings(t *testing.T) {
+	rule := sigma.Rule{Logsource: sigma.Logsource{Product: "windows", Category: "process_creation"}}
+	excluded := []sigma.Config{
+		{Title: "windows", Backends: []string{"es-qs"}, Logsources: map[string]sigma.LogsourceMapping{
+			"process_creation": {Logsource: sigma.Logsource{Product: "windows", Category: "process_creation"}},
+		}},
+		{Title: "linux", Backends: []string{"es-qs"}, Logsources: map[string]sigma.LogsourceMapping{
+			"process_creation": {Logsource: sigma.Logsource{Product: "linux", Category: "process_creation"}},
+		}},
+		{Title: "mappings only", Backends: []string{"es-qs"}},
+	}
+	expected := []string{`config "windows" matches the rule's logsource but was excluded as its backends (es-qs) don't include this one`}
+	if warnings := excludedConfigWarnings(rule, excluded); !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestRunCorpus(t *testing.T) {
+	path := writeRule(t, `
+title: whoami
+detection:
+  selection:
+    CommandLine|contains: whoami
+  condition: selection
+`, `
+event:
+  CommandLine: whoami
+`)
+	corpus := t.TempDir()
+	files := map[string]string{
+		"single.json":       `{"CommandLine": "whoami /all"}`,
+		"lines.jsonl":       "{\"CommandLine\": \"ls\"}\n{\"CommandLine\": \"whoami\"}\n",
+		"array.json":        `[{"CommandLine": "id"}, {"CommandLine": "pwd"}]`,
+		"nested/event.yaml": "CommandLine: cmd /c whoami\n",
+		"ignored.txt":       "CommandLine: whoami\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Join(corpus, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(corpus, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := (&Runner{}).RunCorpus([]string{path}, corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Samples != 6 {
+		t.Errorf("expected 6 samples, got %d", report.Samples)
+	}
+	if len(report.Results) != 1 {
+		t.Fatalf("expected a single result, got %+v", report.Results)
+	}
+	expected := []string{"lines.jsonl#2", filepath.Join("nested", "event.yaml"), "single.json"}
+	if result := report.Results[0]; result.Error != "" || !reflect.DeepEqual(result.Matches, expected) {
+		t.Fatalf("expected matches %v, got %+v", expected, result)
+	}
+}
@@ -0,0 +1,69 @@
+package runner
+
+// TestFileSchema returns a JSON Schema describing a single document in a test file (editors validate each document of a YAML stream separately).
+// A document is either a test case or one of the documents applying to the whole file: anchors, a config, expect_parse_error or the testcases format.
+func TestFileSchema() map[string]interface{} {
+	event := map[string]interface{}{"type": "object", "description": "the fields of the event"}
+	events := map[string]interface{}{"type": "array", "items": event}
+	placeholders := map[string]interface{}{
+		"type":                 "object",
+		"description":          "maps placeholder names (without the surrounding %) to the values they expand to",
+		"additionalProperties": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	}
+
+	testCase := map[string]interface{}{
+		"title":                "test case",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "description": "a description of what the test case is checking"},
+			"match": map[string]interface{}{
+				"description": "whether the rule should match the event (defaults to true), or maybe to report whether it did without passing or failing the test case",
+				"anyOf":       []interface{}{map[string]interface{}{"type": "boolean"}, map[string]interface{}{"const": "maybe"}},
+			},
+			"expect": map[string]interface{}{"const": expectUnknown, "description": "unknown to report whether the rule matched without passing or failing the test case (the same as match: maybe)"},
+			"index":  map[string]interface{}{"type": "string", "description": "accepted for compatibility but currently ignored"},
+			"event": map[string]interface{}{
+				"description": "the event to evaluate the rule against, or a plain string to be searched by the rule's keywords",
+				"type":        []string{"object", "string"},
+			},
+			"events":             map[string]interface{}{"type": "array", "items": event, "description": "a batch of events: the test case matches if any of them match (or the sequence of events for a correlation rule)"},
+			"event_json":         map[string]interface{}{"type": "string", "description": "the event as a JSON object"},
+			"event_file":         map[string]interface{}{"type": "string", "description": "a JSON or YAML file (relative to the test file) to load the event from"},
+			"matched_selections": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "exactly which of the rule's searches should match the event"},
+			"suppressed_by":      map[string]interface{}{"type": "string", "description": "the search (usually a filter) responsible for the event not matching"},
+			"expect_error":       map[string]interface{}{"type": "boolean", "description": "whether evaluating the event should fail instead of checking whether it matches"},
+			"reason":             map[string]interface{}{"type": "string", "description": "why the event should (or shouldn't) match, included in failure messages"},
+			"placeholders":       placeholders,
+		},
+	}
+
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "sigma-test test file",
+		"description": "a document in a sigma-test test file",
+		"anyOf": []interface{}{
+			testCase,
+			wholeFileDocument("anchors", map[string]interface{}{"type": "object", "description": "values to be aliased by later test cases"}),
+			wholeFileDocument("config", map[string]interface{}{"type": "object", "description": "a config (in the same format as a config file) applied to this file's rule"}),
+			wholeFileDocument("expect_parse_error", map[string]interface{}{"type": "boolean", "description": "whether the rule should fail to parse (the file can't contain any test cases)"}),
+			wholeFileDocument("testcases", map[string]interface{}{
+				"type":                 "object",
+				"description":          "the events which should and shouldn't match",
+				"additionalProperties": false,
+				"properties":           map[string]interface{}{"match": events, "dont-match": events},
+			}),
+		},
+	}
+}
+
+// wholeFileDocument describes a document containing only the key, which applies to the whole test file rather than being a test case
+func wholeFileDocument(key string, value map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"title":                key,
+		"type":                 "object",
+		"required":             []string{key},
+		"additionalProperties": false,
+		"properties":           map[string]interface{}{key: value},
+	}
+}
@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTestFileSchemaMatchesTestCase(t *testing.T) {
+	// Every field which can be set in a test case (and nothing else) should be in the schema
+	var fields []string
+	testCase := reflect.TypeOf(TestCase{})
+	for i := 0; i < testCase.NumField(); i++ {
+		name := strings.ToLower(testCase.Field(i).Name)
+		if tag, ok := testCase.Field(i).Tag.Lookup("yaml"); ok {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+
+	branches := TestFileSchema()["anyOf"].([]interface{})
+	var properties []string
+	for name := range branches[0].(map[string]interface{})["properties"].(map[string]interface{}) {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+
+	if !reflect.DeepEqual(fields, properties) {
+		t.Fatalf("expected the schema to describe the fields %v, got %v", fields, properties)
+	}
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+// valueType describes the type of a value as written in YAML
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, uint64, float64:
+		return "a number"
+	default:
+		return ""
+	}
+}
+
+// ruleValueType infers the type a rule's value was written as.
+// The rule parser converts every value to a string so numbers and booleans are recognised by their format.
+func ruleValueType(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "a number"
+	}
+	if value == "true" || value == "false" {
+		return "a boolean"
+	}
+	return "a string"
+}
+
+// typeMismatches warns about event values whose type differs from the values the rule compares them to
+// (e.g. EventID: "1" when the rule expects EventID: 1). Values are compared as strings so these usually still match,
+// but they're a sign that the test event doesn't look like a real one.
+func typeMismatches(rule sigma.Rule, configs []sigma.Config, testCases []TestCase) []string {
+	var warnings []string
+	for i, tc := range testCases {
+		name := tc.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+		warned := map[string]bool{}
+		for _, event := range append([]map[string]interface{}{tc.Event}, tc.Events...) {
+			for _, search := range sortedSearches(rule) {
+				for _, matcher := range rule.Detection.Searches[search].EventMatchers {
+					for _, field := range matcher {
+						if warned[field.Field] || !comparesExactly(field) {
+							continue
+						}
+						eventType := valueType(eventValue(field.Field, configs, event))
+						ruleType := ruleValuesType(field.Values)
+						if eventType == "" || ruleType == "" || eventType == ruleType {
+							continue
+						}
+						warned[field.Field] = true
+						warnings = append(warnings, fmt.Sprintf("%s: event field %s is %s but the rule compares it to %s", name, field.Field, eventType, ruleType))
+					}
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// comparesExactly checks whether a field matcher compares whole values (rather than e.g. substrings or patterns)
+func comparesExactly(field sigma.FieldMatcher) bool {
+	for _, modifier := range field.Modifiers {
+		if modifier != "all" {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleValuesType returns the type of a field's values ("" if they're of different types)
+func ruleValuesType(values []string) string {
+	var valuesType string
+	for i, value := range values {
+		switch {
+		case i == 0:
+			valuesType = ruleValueType(value)
+		case ruleValueType(value) != valuesType:
+			return ""
+		}
+	}
+	return valuesType
+}
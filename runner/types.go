@@ -0,0 +1,389 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"gopkg.in/yaml.v3"
+)
+
+// TestCase is a document in a test file. TestFileSchema describes the fields it accepts so must be kept in sync with it.
+type TestCase struct {
+	Name  string // an optional description of what the test case is checking
+	Match *bool
+	Index string
+	Event map[string]interface{}
+
+	// Events is a batch of events: for ordinary rules the test case matches if any of them match,
+	// for correlation rules they are the ordered sequence of events fed through the correlation
+	Events []map[string]interface{}
+
+	// Message is set instead of Event when the event is a plain string (e.g. a raw log line) to be searched by the rule's keywords
+	Message string `yaml:"-"`
+
+	// EventJSON is an alternative to Event for supplying the event as a JSON object (e.g. a captured log line)
+	EventJSON string `yaml:"event_json"`
+	// EventFile is an alternative to Event for loading the event from a JSON or YAML file (relative to the test file)
+	EventFile string `yaml:"event_file"`
+
+	// MatchedSelections optionally asserts exactly which of the rule's searches match the event
+	MatchedSelections []string `yaml:"matched_selections"`
+
+	// SuppressedBy optionally asserts that the event didn't match because of this search (usually a filter):
+	// the search must have matched and the rule would have matched without it. Test cases with it default to match: false.
+	SuppressedBy string `yaml:"suppressed_by"`
+
+	// Expect set to unknown (or equivalently match: maybe) evaluates the test case and reports whether the rule matched without passing or failing it,
+	// for test cases whose expected outcome hasn't been confirmed yet
+	Expect string `yaml:"expect"`
+
+	// ExpectError asserts that the rule fails to evaluate the event (e.g. because it uses a modifier the evaluator doesn't support) instead of whether it matches
+	ExpectError bool `yaml:"expect_error"`
+
+	// Reason optionally explains why the event should (or shouldn't) match and is included in failure messages
+	Reason string
+
+	// Placeholders maps placeholder names (without the surrounding %) to the values they expand to
+	Placeholders map[string][]string
+}
+
+// testSuite is the contents of a test file
+type testSuite struct {
+	Cases        []TestCase
+	Placeholders map[string][]string // placeholder values declared for all the test cases
+	Config       *sigma.Config       // a config applied to the rule (in addition to the relevant configs) when testing it with this file
+
+	// ExpectParseError asserts that the rule file fails to parse (e.g. for a suite of deliberately malformed rules) instead of it being tested
+	ExpectParseError bool
+}
+
+// getTestCases parses the test cases from a test file along with any placeholder values and config declared for the whole file
+func getTestCases(path string) (testSuite, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return testSuite{}, nil
+	}
+	if err != nil {
+		return testSuite{}, err
+	}
+
+	documents, err := decodeTestDocuments(contents)
+	if err != nil {
+		return testSuite{}, fmt.Errorf("error parsing test cases: %w", err)
+	}
+
+	suite := testSuite{Placeholders: map[string][]string{}}
+	for _, document := range documents {
+		// A document with only anchors declares values to be shared by the test cases rather than being one itself
+		if isAnchorsDocument(document) {
+			continue
+		}
+		// Empty documents (e.g. after a trailing "---") aren't test cases.
+		// A test case which deliberately has no event still has other keys (e.g. match: false) so isn't skipped.
+		if isEmptyDocument(document) {
+			continue
+		}
+		// A document with only a config declares field mappings etc. which only apply to this file's rule
+		if isConfigDocument(document) {
+			if suite.Config != nil {
+				return testSuite{}, fmt.Errorf("error parsing config: only one config can be declared in a test file")
+			}
+			config, err := parseConfigNode(document.Content[1])
+			if err != nil {
+				return testSuite{}, fmt.Errorf("error parsing config: %w", err)
+			}
+			if config.Title == "" {
+				config.Title = filepath.Base(path) // so it can be identified when showing mappings
+			}
+			suite.Config = &config
+			continue
+		}
+		// A document with only expect_parse_error asserts that the rule can't be parsed
+		if isParseErrorDocument(document) {
+			if err := document.Content[1].Decode(&suite.ExpectParseError); err != nil {
+				return testSuite{}, fmt.Errorf("error parsing expect_parse_error: %w", err)
+			}
+			continue
+		}
+		// The testcases format lists the events which should and shouldn't match in a single document
+		if hasKey(document, "testcases") {
+			listed := TestCases{}
+			if err := document.Decode(&listed); err != nil {
+				return testSuite{}, fmt.Errorf("error parsing testcases: %w", err)
+			}
+			// The lists are added in the order they appear so that test cases (and their failures) are in file order
+			for _, key := range mappingKeys(document, "testcases") {
+				var events []map[string]interface{}
+				match := key == "match"
+				switch key {
+				case "match":
+					events = listed.Cases.Match
+				case "dont-match":
+					events = listed.Cases.DontMatch
+				}
+				for _, event := range events {
+					suite.Cases = append(suite.Cases, TestCase{Match: boolPointer(match), Event: event})
+				}
+			}
+			continue
+		}
+		testCase := TestCase{}
+		// A plain string event can't be decoded into Event so is taken out of the document first
+		if message, ok := stringEvent(&document); ok {
+			testCase.Message = message
+		}
+		// Likewise match: maybe isn't a bool
+		if maybeMatch(&document) {
+			testCase.Expect = expectUnknown
+		}
+		if err := document.Decode(&testCase); err != nil {
+			return testSuite{}, fmt.Errorf("error parsing test case %d: %w", len(suite.Cases)+1, err)
+		}
+		if err := testCase.loadEvent(filepath.Dir(path)); err != nil {
+			return testSuite{}, fmt.Errorf("error parsing test case %d: %w", len(suite.Cases)+1, err)
+		}
+		// A document with placeholders but no event (in any form) or match declares placeholder values for all the test cases
+		if isPlaceholdersDocument(document, testCase) {
+			for name, values := range testCase.Placeholders {
+				suite.Placeholders[name] = values
+			}
+			continue
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return suite, nil
+}
+
+// decodeTestDocuments decodes each of the YAML documents in a test file as a node.
+// They're decoded with a single decoder so that aliases can refer to anchors defined in earlier documents.
+func decodeTestDocuments(contents []byte) ([]yaml.Node, error) {
+	var documents []yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if document.Kind == yaml.DocumentNode && len(document.Content) == 1 {
+			document = *document.Content[0]
+		}
+		documents = append(documents, document)
+	}
+}
+
+func isAnchorsDocument(document yaml.Node) bool {
+	return document.Kind == yaml.MappingNode && len(document.Content) == 2 && document.Content[0].Value == "anchors"
+}
+
+func isConfigDocument(document yaml.Node) bool {
+	return document.Kind == yaml.MappingNode && len(document.Content) == 2 && document.Content[0].Value == "config"
+}
+
+// mappingKeys returns the keys of the mapping under key in the document, in the order they appear
+func mappingKeys(document yaml.Node, key string) []string {
+	var keys []string
+	for i := 0; i+1 < len(document.Content); i += 2 {
+		if document.Content[i].Value != key || document.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		value := document.Content[i+1]
+		for j := 0; j < len(value.Content); j += 2 {
+			keys = append(keys, value.Content[j].Value)
+		}
+	}
+	return keys
+}
+
+func isParseErrorDocument(document yaml.Node) bool {
+	return document.Kind == yaml.MappingNode && len(document.Content) == 2 && document.Content[0].Value == "expect_parse_error"
+}
+
+// parseConfigNode parses a config embedded in a test file the same way as a config file
+func parseConfigNode(node *yaml.Node) (sigma.Config, error) {
+	contents, err := yaml.Marshal(node)
+	if err != nil {
+		return sigma.Config{}, err
+	}
+	return sigma.ParseConfig(contents)
+}
+
+// isEmptyDocument checks whether a document has no content (other than comments)
+func isEmptyDocument(document yaml.Node) bool {
+	switch document.Kind {
+	case 0:
+		return true
+	case yaml.ScalarNode:
+		return document.Tag == "!!null"
+	case yaml.MappingNode:
+		return len(document.Content) == 0
+	default:
+		return false
+	}
+}
+
+// stringEvent removes the event from a test case document if it's a plain string, returning it
+func stringEvent(document *yaml.Node) (string, bool) {
+	if document.Kind != yaml.MappingNode {
+		return "", false
+	}
+	for i := 0; i < len(document.Content); i += 2 {
+		value := document.Content[i+1]
+		if document.Content[i].Value != "event" || value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+			continue
+		}
+		document.Content = append(document.Content[:i:i], document.Content[i+2:]...)
+		return value.Value, true
+	}
+	return "", false
+}
+
+// expectUnknown is the value of Expect for test cases whose outcome is reported without passing or failing them
+const expectUnknown = "unknown"
+
+// maybeMatch removes match: maybe from a test case document, returning whether it was there
+func maybeMatch(document *yaml.Node) bool {
+	if document.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(document.Content); i += 2 {
+		value := document.Content[i+1]
+		if document.Content[i].Value != "match" || value.Kind != yaml.ScalarNode || value.Value != "maybe" {
+			continue
+		}
+		document.Content = append(document.Content[:i:i], document.Content[i+2:]...)
+		return true
+	}
+	return false
+}
+
+// isPlaceholdersDocument checks whether a test case document only declares placeholder values.
+// The string event and match: maybe have already been taken out of the document so are checked on the decoded test case.
+func isPlaceholdersDocument(document yaml.Node, testCase TestCase) bool {
+	if testCase.Placeholders == nil || testCase.Message != "" || testCase.Expect != "" {
+		return false
+	}
+	for _, key := range []string{"event", "events", "event_json", "event_file", "match"} {
+		if hasKey(document, key) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasKey(document yaml.Node, key string) bool {
+	if document.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(document.Content); i += 2 {
+		if document.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
+
+// describe identifies the test case in failure messages by its name (or its event if it doesn't have one)
+func (tc TestCase) describe() string {
+	if tc.Name != "" {
+		return strconv.Quote(tc.Name)
+	}
+	if tc.Events != nil {
+		return fmt.Sprint(tc.Events)
+	}
+	if tc.Message != "" {
+		return strconv.Quote(tc.Message)
+	}
+	return fmt.Sprint(tc.Event)
+}
+
+// events returns the events to evaluate for the test case
+// (a plain string event is searched by keywords so becomes an event with only keywordsField)
+func (tc TestCase) events() []map[string]interface{} {
+	switch {
+	case tc.Events != nil:
+		return tc.Events
+	case tc.Message != "":
+		return []map[string]interface{}{{keywordsField: tc.Message}}
+	default:
+		return []map[string]interface{}{tc.Event}
+	}
+}
+
+// explainedReason is appended to failure messages to include the author's reason for the expected outcome
+func (tc TestCase) explainedReason() string {
+	if tc.Reason == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (reason: %s)", tc.Reason)
+}
+
+// loadEvent populates the test case's Event from any of the alternative ways of specifying it.
+// Event files are resolved relative to dir (the directory containing the test file).
+func (tc *TestCase) loadEvent(dir string) error {
+	specified := 0
+	for _, set := range []bool{tc.Event != nil || tc.Message != "", tc.EventJSON != "", tc.EventFile != "", tc.Events != nil} {
+		if set {
+			specified++
+		}
+	}
+	if specified > 1 {
+		return fmt.Errorf("only one of event, event_json, event_file and events can be specified")
+	}
+	if tc.SuppressedBy != "" && tc.Events != nil {
+		return fmt.Errorf("suppressed_by can't be used with events")
+	}
+	switch {
+	case tc.Expect != "" && tc.Expect != expectUnknown:
+		return fmt.Errorf("invalid expect %q (the only supported value is %s)", tc.Expect, expectUnknown)
+	case tc.Expect == expectUnknown && (tc.Match != nil || tc.ExpectError || tc.SuppressedBy != "" || tc.MatchedSelections != nil):
+		return fmt.Errorf("a test case with an unknown expectation can't also set match, expect_error, suppressed_by or matched_selections")
+	}
+
+	switch {
+	case tc.EventJSON != "":
+		if err := json.Unmarshal([]byte(tc.EventJSON), &tc.Event); err != nil {
+			return fmt.Errorf("invalid event_json: %w", err)
+		}
+
+	case tc.EventFile != "":
+		eventPath := filepath.Join(dir, tc.EventFile)
+		contents, err := os.ReadFile(eventPath)
+		if err != nil {
+			return fmt.Errorf("error reading event_file: %w", err)
+		}
+		if filepath.Ext(eventPath) == ".json" {
+			err = json.Unmarshal(contents, &tc.Event)
+		} else {
+			err = yaml.Unmarshal(contents, &tc.Event)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing event_file %s: %w", eventPath, err)
+		}
+	}
+	return nil
+}
+
+// TestCases is an alternative format for test files listing the events which should and shouldn't match
+type TestCases struct {
+	Cases struct {
+		Match     []map[string]interface{} `yaml:"match"`
+		DontMatch []map[string]interface{} `yaml:"dont-match"`
+	} `yaml:"testcases"`
+}
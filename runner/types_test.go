@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrailingDocuments(t *testing.T) {
+	tests := map[string]struct {
+		contents string
+		cases    int
+	}{
+		"trailing separator": {"match: true\nevent:\n  a: foo\n---\n", 1},
+		"trailing comment":   {"match: true\nevent:\n  a: foo\n---\n# TODO: more cases\n", 1},
+		"empty middle":       {"match: true\nevent:\n  a: foo\n---\n---\nmatch: false\nevent:\n  a: bar\n", 2},
+		"empty event":        {"match: true\nevent:\n  a: foo\n---\nname: empty event\nmatch: false\n", 2},
+		"yaml directive":     {"%YAML 1.1\n---\nmatch: true\nevent:\n  a: foo\n", 1},
+		"tag directive":      {"%TAG !s! tag:yaml.org,2002:\n---\nmatch: true\nevent:\n  a: !s!str foo\n", 1},
+		"anchors":            {"anchors:\n  base: &base\n    a: foo\n---\nmatch: true\nevent: *base\n---\nmatch: false\nevent:\n  <<: *base\n  b: bar\n", 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rule_test.yaml")
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			suite, err := getTestCases(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suite.Cases) != tt.cases {
+				t.Fatalf("expected %d test cases, got %d: %+v", tt.cases, len(suite.Cases), suite.Cases)
+			}
+		})
+	}
+}
+
+func TestParseErrorLineNumber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rule_test.yaml")
+	contents := "match: true\nevent:\n  a: foo\n---\nevent:\n  a: bar\nmatch: nope\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := getTestCases(path)
+	if err == nil || !strings.Contains(err.Error(), "line 7") {
+		t.Fatalf("expected an error on line 7, got %v", err)
+	}
+}
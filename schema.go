@@ -0,0 +1,15 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// dumpSchema writes the JSON Schema for test files
+func dumpSchema(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(runner.TestFileSchema())
+}
@@ -1,228 +1,537 @@
 package main
 
 import (
-	"context"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
-	"text/tabwriter"
+	"time"
 
 	"github.com/bradleyjkemp/sigma-go"
-	"github.com/bradleyjkemp/sigma-go/evaluator"
+	"github.com/bradleyjkemp/sigma-test/runner"
 	"gopkg.in/yaml.v3"
 )
 
 var (
-	fRecursive   = flag.Bool("recursive", true, "whether to test directories recursively")
-	fConfigFiles = flag.String("config-files", "", "a pattern for config files to use when evaluating rules")
+	fRecursive         = flag.Bool("recursive", true, "whether to test directories recursively")
+	fConfigFiles       = flag.String("config-files", "", "a pattern for config files to use when evaluating rules (environment variables like $CONFIG_DIR are expanded)")
+	fConfigDir         = flag.String("config-dir", "", "a directory to recursively load config files from")
+	fOutput            = flag.String("output", "table", "the format to output results in (table, json, junit, tap or github)")
+	fColor             = flag.String("color", "auto", "whether to colour table output (always, never or auto to only colour output to a terminal)")
+	fOutputFile        = flag.String("output-file", "", "a file to write results to instead of stdout")
+	fVerbose           = flag.Bool("verbose", false, "whether to report which searches matched for failing test cases (and warn about configs excluded by -backend which match a rule's logsource)")
+	fJobs              = flag.Int("jobs", runtime.GOMAXPROCS(0), "the number of rules to test concurrently")
+	fWatch             = flag.Bool("watch", false, "whether to keep running and re-test rules when they change")
+	fRulePattern       = flag.String("rule-pattern", "*.yaml,*.yml", "comma-separated glob patterns for the names of files containing rules")
+	fTestSuffix        = flag.String("test-suffix", "_test", "the suffix added to a rule's filename (before the extension) to find its test file")
+	fTestDir           = flag.String("test-dir", "", "a directory of test files mirroring the layout of -rules-dir (instead of test files being next to their rules)")
+	fRulesDir          = flag.String("rules-dir", ".", "the directory whose layout -test-dir mirrors")
+	fTimeout           = flag.Duration("timeout", 0, "the maximum time to spend evaluating a single event (e.g. 2s); 0 means no limit")
+	fFailFast          = flag.Bool("fail-fast", false, "whether to stop testing after the first failing rule")
+	fCoverage          = flag.Bool("coverage", false, "whether to report how many of each rule's detection fields are exercised by its test cases")
+	fCoverageOut       = flag.String("coverage-out", "", "a file to write each rule's field coverage to as JSON (implies -coverage)")
+	fRequireTests      = flag.Bool("require-tests", false, "whether rules without any test cases should fail the run (instead of being skipped)")
+	fAllowEmpty        = flag.Bool("allow-empty", false, "whether finding no rules to test should pass (implied by -changed) instead of being an error")
+	fCheckConfigured   = flag.Bool("check-configured", false, "whether to report rules which no config applies to as errors (instead of evaluating them with every config)")
+	fAllowUnconfigured = flag.Bool("allow-unconfigured", false, "whether rules which no config applies to should be listed as unconfigured without failing the run")
+	fBackend           = flag.String("backend", "github.com/bradleyjkemp/sigma-go", "only use configs which list this backend")
+	fCheckDuplicateIDs = flag.Bool("check-duplicate-ids", false, "whether to fail if any rule ID is used in more than one file")
+	fCheckEventFields  = flag.Bool("check-event-fields", false, "whether to warn about test case event fields which aren't used by the rule or its configs")
+	fCheckLevels       = flag.Bool("check-levels", false, "whether to report rules without a valid level (informational, low, medium, high or critical) as errors")
+	fCaseInsensitive   = flag.Bool("case-insensitive-fields", false, "whether to ignore the case of field names when matching rules (and configs) against test case events")
+	fStrict            = flag.Bool("strict", false, "whether to fail the run for any problem: implies -require-tests, -check-configured, -check-duplicate-ids, -check-event-fields, -check-levels and -strict-types, disables -allow-unconfigured and reports warnings and unknown test file fields as errors")
+	fStrictTypes       = flag.Bool("strict-types", false, "whether to warn about test case event values which are a different type (string, number or boolean) to those the rule compares them to")
+	fValidateConfig    = flag.Bool("validate-config", false, "print the loaded configs and check them for problems instead of testing rules")
+	fID                = flag.String("id", "", "only test the rule with this ID")
+	fName              = flag.String("name", "", "only test rules whose title contains this (case-insensitive)")
+	fProduct           = flag.String("product", "", "only test rules with this logsource product")
+	fCategory          = flag.String("category", "", "only test rules with this logsource category")
+	fService           = flag.String("service", "", "only test rules with this logsource service")
+	fShowMappings      = flag.Bool("show-mappings", false, "whether to show the configs applied to each rule and the event fields its fields are mapped to")
+	fExplain           = flag.Bool("explain", false, "whether to report which of the rule's fields matched for failing test cases")
+	fFingerprint       = flag.Bool("fingerprint", false, "whether to output a hash of each rule's ID, test case outcomes and configs which only changes when one of them does")
+	fBenchmark         = flag.Duration("benchmark", 0, "after testing each rule, repeatedly evaluate its test case events for this long (e.g. 1s) and report its throughput")
+	fGroupByDir        = flag.Bool("group-by-dir", false, "whether to add the number of rules with each status in each directory (and its subdirectories) to the summary")
+	fTopSlow           = flag.Int("top-slow", 0, "list this many of the slowest rules to test after the summary")
+	fMaxFailures       = flag.Int("max-failures", 0, "stop printing the details of failing test cases after this many (0 means no limit)")
+	fProgress          = flag.Bool("progress", false, "whether to show how many rule files have been tested so far on stderr (only when stderr is a terminal)")
+	fQuiet             = flag.Bool("quiet", false, "only output rules which failed or errored (the summary still counts every rule)")
+	fSummaryOnly       = flag.Bool("summary-only", false, "only output the summary (to stdout instead of stderr) without any per-rule results unless they're written to -output-file")
+	fNoCache           = flag.Bool("no-cache", false, "whether to re-parse every rule and test file instead of reusing those cached from previous runs")
+	fShuffle           = flag.Bool("shuffle", false, "whether to test rules in a random order")
+	fSeed              = flag.Int64("seed", 0, "the seed used to shuffle rules (0 picks a random seed)")
+	fPlaceholders      = flag.String("placeholders", "", "a YAML file mapping placeholder names to the values they expand to for every rule")
+	fPreprocess        = flag.String("preprocess", "", "a YAML file describing how to normalise test case events before evaluating them (e.g. renaming vendor-specific fields)")
+	fLogLevel          = flag.String("log-level", "warn", "the level of messages to log to stderr about finding and testing rules (debug, info, warn or error)")
+	fList              = flag.Bool("list", false, "list the rules which would be tested along with their test files instead of testing them")
+	fLintTests         = flag.Bool("lint-tests", false, "check that the test files of the rules which would be tested parse without unknown fields and contain test cases, instead of testing them")
+	fCorpus            = flag.String("corpus", "", "a directory of captured events (JSON or YAML files) to evaluate every rule which would be tested against, reporting which samples each rule matched instead of running its test cases")
+	fChanged           = flag.Bool("changed", false, "only test rules which have changed (or whose test files have changed) according to git diff against -changed-base")
+	fChangedBase       = flag.String("changed-base", "origin/main", "the git revision to compare against to find changed rules when using -changed")
+	fGitignore         = flag.Bool("gitignore", false, "whether to skip files and directories ignored by git (e.g. due to .gitignore)")
+	fDefaultExcludes   = flag.Bool("default-excludes", true, "whether to skip node_modules and vendor directories")
+	fFromFile          = flag.String("from-file", "", "a file listing the paths of rules to test (one per line), tested in addition to any paths given as arguments")
+	fDumpSchema        = flag.Bool("dump-schema", false, "print a JSON Schema describing the test file format (for editor autocompletion and validation)")
+	fVersion           = flag.Bool("version", false, "print the version of sigma-test and of the sigma-go library and Go it was built with")
+	fStdinTests        = flag.String("stdin-tests", "", "read a rule from stdin and test it using the test cases in this file (instead of testing paths)")
+
+	fTags     stringsFlag
+	fExcludes stringsFlag
+)
+
+func init() {
+	flag.Var(&fTags, "tag", "only test rules with this tag (can be repeated)")
+	flag.Var(&fExcludes, "exclude", "a glob pattern for files and directories to skip (can be repeated)")
+}
+
+// defaultExcludes are skipped unless -default-excludes=false as they contain dependencies rather than rules
+var defaultExcludes = []string{"node_modules", "vendor"}
+
+// The exit codes distinguish between rules failing their tests and rules which couldn't be tested at all
+const (
+	exitFailed = 1 // some rules failed their tests
+	exitError  = 2 // some rules couldn't be tested (e.g. they couldn't be read or parsed) or the configs couldn't be loaded
 )
 
 func main() {
 	flag.Parse()
+	if *fVersion {
+		printVersion(os.Stdout)
+		return
+	}
+	if *fDumpSchema {
+		if err := dumpSchema(os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		return
+	}
 	paths := flag.Args()
-	if len(paths) == 0 {
+	if *fFromFile != "" {
+		listed, err := readManifest(*fFromFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		paths = append(paths, listed...)
+	} else if len(paths) == 0 {
 		paths = []string{"."}
 	}
 
-	configs, err := loadConfigs()
+	configs, excluded, err := loadConfigs()
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
-	allPassed := true
-	for _, path := range paths {
-		pass, err := run(path, configs, *fRecursive)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+	if *fValidateConfig {
+		if !validateConfigs(configs, os.Stdout) {
+			os.Exit(exitFailed)
 		}
-		allPassed = allPassed && pass
+		return
 	}
 
-	if !allPassed {
-		os.Exit(1)
+	r := newRunner(configs)
+	r.ExcludedConfigs = excluded
+	if r.Logger, err = newLogger(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
 	}
-}
-
-func run(root string, configs []sigma.Config, recursive bool) (bool, error) {
-	results := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
-	passed := true
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			if path != root && !recursive {
-				return filepath.SkipDir
-			}
-			return nil
+	if r.Placeholders, err = loadPlaceholders(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if r.Preprocess, err = loadPreprocess(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	if *fGitignore {
+		if r.Filter.IgnoredPaths, err = gitIgnoredFiles(); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
 		}
-
-		if filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml" {
-			return nil
+	}
+	if *fChanged {
+		if r.Filter.Paths, err = changedFiles(*fChangedBase); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
 		}
-
-		contents, err := os.ReadFile(path)
+	}
+	if *fList {
+		if err := listRules(r, paths, os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		return
+	}
+	if *fLintTests {
+		valid, err := lintTests(r, paths, os.Stdout)
 		if err != nil {
-			return fmt.Errorf("error reading %s: %w", path, err)
+			fmt.Println(err)
+			os.Exit(exitError)
 		}
-
-		if sigma.InferFileType(contents) != sigma.RuleFile {
-			return nil
+		if !valid {
+			os.Exit(exitFailed)
 		}
-		rule, err := sigma.ParseRule(contents)
+		return
+	}
+	if *fCorpus != "" {
+		valid, err := runCorpus(r, paths, *fCorpus, os.Stdout)
 		if err != nil {
-			return fmt.Errorf("error parsing %s: %w", path, err)
+			fmt.Println(err)
+			os.Exit(exitError)
+		}
+		if !valid {
+			os.Exit(exitError)
 		}
+		return
+	}
 
-		err, failures := testFile(path, rule, configs)
+	w := os.Stdout
+	if *fOutputFile != "" {
+		w, err = os.Create(*fOutputFile)
 		if err != nil {
-			if errors.Is(err, errFailedTests) {
-				passed = false
-			}
-			fmt.Fprintf(results, "%s\t%v\t\n", path, err)
-			for _, failure := range failures {
-				fmt.Fprintf(results, "\t%v\n", failure)
-			}
-		} else {
-			fmt.Fprintf(results, "%s\tPASS\t\n", path)
+			fmt.Println(err)
+			os.Exit(exitError)
 		}
-		return nil
-	})
+		defer w.Close()
+	}
 
-	results.Flush()
-	return passed, err
-}
+	out, summary, err := newOutput(w, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
 
-func loadConfigs() ([]sigma.Config, error) {
-	if *fConfigFiles == "" {
-		return nil, nil
+	if r.Shuffle {
+		// Print the seed first so that a failing order can be reproduced even if the run doesn't finish
+		fmt.Fprintf(os.Stderr, "shuffling rules with -seed=%d\n", r.Seed)
+	}
+	r.OnResult = out.Report
+	progress := *fProgress && isTerminal(os.Stderr)
+	if progress {
+		r.OnProgress = func(tested, total int) {
+			fmt.Fprintf(os.Stderr, "\rprocessed %d/%d", tested, total)
+		}
+	}
+	var report runner.Report
+	if *fStdinTests != "" {
+		report, err = r.RunReader("<stdin>", os.Stdin, *fStdinTests)
+	} else {
+		report, err = r.Run(paths)
+	}
+	if progress {
+		// Clear the progress line so it doesn't run into the summary
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
 	}
-	var configs []sigma.Config
-	configFilepaths, err := filepath.Glob(*fConfigFiles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to identify config files: %w", err)
+		fmt.Println(err)
+		os.Exit(exitError)
 	}
 
-	for _, configFilepath := range configFilepaths {
-		configBytes, err := os.ReadFile(configFilepath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read config file %s: %w", configFilepath, err)
+	if err := out.Close(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitError)
+	}
+	fmt.Fprintln(summary, out)
+	if *fCoverageOut != "" {
+		if err := writeCoverage(*fCoverageOut, report); err != nil {
+			fmt.Println(err)
+			os.Exit(exitError)
 		}
+	}
+	for _, id := range sortedIDs(report.DuplicateIDs) {
+		fmt.Fprintf(os.Stderr, "duplicate rule ID %s used in %s\n", id, strings.Join(report.DuplicateIDs[id], ", "))
+	}
+	if err := r.Cache.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 
-		config, err := sigma.ParseConfig(configBytes)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse config file %s: %w", configFilepath, err)
+	if *fWatch && *fStdinTests == "" {
+		if err := watch(paths, r, w); err != nil {
+			fmt.Println(err)
 		}
+		os.Exit(exitError)
+	}
 
-		for _, backend := range config.Backends {
-			if backend == "github.com/bradleyjkemp/sigma-go" {
-				configs = append(configs, config)
-				break
-			}
+	switch {
+	case report.Errored:
+		os.Exit(exitError)
+	case !report.Passed:
+		os.Exit(exitFailed)
+	}
+}
+
+// newOutput builds the reporter for a run's results from the output flags, returning it along with where to print its summary.
+// Results are written to w, which is either the -output-file or stdout.
+func newOutput(w, stdout, stderr io.Writer) (*summaryReporter, io.Writer, error) {
+	formatter, err := newReporter(*fOutput, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *fQuiet {
+		formatter = quietReporter{formatter}
+	}
+	summary := stderr
+	if *fSummaryOnly {
+		summary = stdout
+		// Only stdout is limited to the summary so results written to a file (e.g. a JUnit report for CI) are kept
+		if w == stdout {
+			formatter = discardReporter{}
 		}
 	}
+	out := &summaryReporter{reporter: formatter, topSlow: *fTopSlow}
+	if *fGroupByDir {
+		out.directories = &directoryNode{}
+	}
+	return out, summary, nil
+}
 
-	return configs, nil
+func sortedIDs(duplicates map[string][]string) []string {
+	var ids []string
+	for id := range duplicates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
-var (
-	errNoTests     = fmt.Errorf("SKIP")
-	errFailedTests = fmt.Errorf("FAIL")
-)
+// newRunner configures a runner from the command line flags
+func newRunner(configs []sigma.Config) *runner.Runner {
+	r := &runner.Runner{
+		Configs:               configs,
+		Recursive:             *fRecursive,
+		AllowEmpty:            *fAllowEmpty || *fChanged, // not changing any rules is the usual case for -changed
+		Jobs:                  *fJobs,
+		TestSuffix:            *fTestSuffix,
+		TestDir:               *fTestDir,
+		RulesDir:              *fRulesDir,
+		Timeout:               *fTimeout,
+		FailFast:              *fFailFast,
+		Coverage:              *fCoverage || *fCoverageOut != "",
+		RequireTests:          *fRequireTests,
+		CheckConfigured:       *fCheckConfigured,
+		AllowUnconfigured:     *fAllowUnconfigured,
+		Verbose:               *fVerbose,
+		Explain:               *fExplain,
+		ShowMappings:          *fShowMappings,
+		CheckDuplicateIDs:     *fCheckDuplicateIDs,
+		CheckEventFields:      *fCheckEventFields,
+		StrictTypes:           *fStrictTypes,
+		CaseInsensitiveFields: *fCaseInsensitive,
+		CheckLevels:           *fCheckLevels,
+		Shuffle:               *fShuffle,
+		Seed:                  *fSeed,
+		Benchmark:             *fBenchmark,
+		Fingerprint:           *fFingerprint,
+		Filter: runner.Filter{
+			Tags:     fTags,
+			ID:       *fID,
+			Name:     *fName,
+			Excludes: fExcludes,
+			Logsource: sigma.Logsource{
+				Product:  *fProduct,
+				Category: *fCategory,
+				Service:  *fService,
+			},
+		},
+	}
+	if *fStrict {
+		r.RequireTests = true
+		r.CheckConfigured = true
+		r.AllowUnconfigured = false
+		r.CheckDuplicateIDs = true
+		r.CheckEventFields = true
+		r.CheckLevels = true
+		r.StrictTypes = true
+		r.StrictTestFiles = true
+		r.WarningsAsErrors = true
+	}
+	if r.Benchmark > 0 {
+		// Rules benchmarked concurrently would compete for the CPU and skew each other's results
+		r.Jobs = 1
+	}
+	if *fDefaultExcludes {
+		r.Filter.Excludes = append(r.Filter.Excludes, defaultExcludes...)
+	}
+	for _, pattern := range strings.Split(*fRulePattern, ",") {
+		r.RulePatterns = append(r.RulePatterns, strings.TrimSpace(pattern))
+	}
+	if r.Shuffle && r.Seed == 0 {
+		r.Seed = time.Now().UnixNano()
+	}
+	if !*fNoCache {
+		if path, err := runner.DefaultCachePath(); err == nil {
+			r.Cache = runner.LoadCache(path)
+		}
+	}
+	return r
+}
 
-func testFile(path string, r sigma.Rule, configs []sigma.Config) (error, []string) {
-	ext := filepath.Ext(path)
-	testFilename := strings.TrimSuffix(path, ext) + "_test" + ext
+// newLogger creates a logger writing to stderr at the level given by -log-level
+func newLogger() (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*fLogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid -log-level: %w", err)
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})), nil
+}
 
-	testCases, err := getTestCases(testFilename)
+// readManifest reads the paths listed in a file (one per line), ignoring blank lines and comments starting with #
+func readManifest(path string) ([]string, error) {
+	contents, err := os.ReadFile(path)
 	if err != nil {
-		return err, nil
+		return nil, fmt.Errorf("error reading -from-file: %w", err)
 	}
-	if len(testCases) == 0 {
-		return errNoTests, nil
+	var paths []string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
 	}
+	return paths, nil
+}
 
-	rule := evaluator.ForRule(r, evaluator.WithConfig(configs...), evaluator.WithPlaceholderExpander(func(ctx context.Context, placeholderName string) ([]string, error) {
-		// TODO: allow test-writers to supply placeholder values
-		return nil, nil
-	}))
-	pass := true
-	var failures []string
-
-	for _, tc := range testCases {
-		shouldMatch := true
-		if tc.Match != nil { // by default, test cases match
-			shouldMatch = *tc.Match
-		}
-		result, _ := rule.Matches(context.Background(), tc.Event)
-		switch {
-		case shouldMatch && !result.Match:
-			pass = false
-			failures = append(failures, fmt.Sprintf("%v should have matched", tc.Event))
-		case !shouldMatch && result.Match:
-			pass = false
-			failures = append(failures, fmt.Sprintf("%v shouldn't have matched", tc.Event))
-		}
-	}
-	if pass {
+// loadPlaceholders loads the global placeholder values (if a placeholders file was given)
+func loadPlaceholders() (map[string][]string, error) {
+	if *fPlaceholders == "" {
 		return nil, nil
 	}
-	return errFailedTests, failures
+	contents, err := os.ReadFile(*fPlaceholders)
+	if err != nil {
+		return nil, fmt.Errorf("error reading placeholders: %w", err)
+	}
+	placeholders := map[string][]string{}
+	if err := yaml.Unmarshal(contents, &placeholders); err != nil {
+		return nil, fmt.Errorf("error parsing placeholders from %s: %w", *fPlaceholders, err)
+	}
+	return placeholders, nil
 }
 
-func getTestCases(path string) ([]TestCase, error) {
-	testFile, err := os.Open(path)
-	if errors.Is(err, fs.ErrNotExist) {
+// preprocessConfig describes how test case events are normalised before evaluation
+type preprocessConfig struct {
+	// Rename maps the names of fields in the captured events (dotted paths for nested fields) to the names used by rules
+	Rename map[string]string `yaml:"rename"`
+}
+
+// loadPreprocess loads the function normalising test case events (if a preprocess file was given)
+func loadPreprocess() (func(map[string]interface{}) map[string]interface{}, error) {
+	if *fPreprocess == "" {
 		return nil, nil
 	}
+	contents, err := os.ReadFile(*fPreprocess)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error reading preprocess config: %w", err)
 	}
+	var config preprocessConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing preprocess config from %s: %w", *fPreprocess, err)
+	}
+	return runner.RenameFields(config.Rename), nil
+}
 
-	var testCases []TestCase
-	decoder := yaml.NewDecoder(testFile)
-	for {
-		testCase := TestCase{}
-		err = decoder.Decode(&testCase)
+// loadConfigs loads the configs listing -backend, along with those which were excluded for not listing it
+func loadConfigs() (configs []sigma.Config, excluded []sigma.Config, err error) {
+	var configFilepaths []string
+	if *fConfigFiles != "" {
+		// Expand environment variables so that CI pipelines can parameterise the config location
+		matches, err := filepath.Glob(os.ExpandEnv(*fConfigFiles))
 		if err != nil {
-			break
+			return nil, nil, fmt.Errorf("failed to identify config files: %w", err)
 		}
-		testCases = append(testCases, testCase)
+		configFilepaths = append(configFilepaths, matches...)
 	}
-	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("error parsing test cases: %w", err)
+	if *fConfigDir != "" {
+		err := filepath.Walk(*fConfigDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml") {
+				configFilepaths = append(configFilepaths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to identify config files: %w", err)
+		}
 	}
 
-	// If there's a trailing end of document marker ("---") then there's an empty final test case we need to remove
-	if testCases[len(testCases)-1].Event == nil {
-		testCases = testCases[:len(testCases)-1]
-	}
+	for _, configFilepath := range configFilepaths {
+		configBytes, err := os.ReadFile(configFilepath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config file %s: %w", configFilepath, err)
+		}
 
-	return testCases, nil
-}
+		// A file can contain several configs as separate YAML documents
+		documents, err := splitDocuments(configBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse config file %s: %w", configFilepath, err)
+		}
+		for i, document := range documents {
+			// Config directories may contain other YAML files (e.g. documentation) which can be ignored
+			if *fConfigDir != "" && sigma.InferFileType(document) != sigma.ConfigFile {
+				continue
+			}
+
+			config, err := sigma.ParseConfig(document)
+			if err != nil {
+				if len(documents) > 1 {
+					return nil, nil, fmt.Errorf("failed to parse config file %s (document %d): %w", configFilepath, i+1, err)
+				}
+				return nil, nil, fmt.Errorf("failed to parse config file %s: %w", configFilepath, err)
+			}
 
-type TestCases struct {
-	Cases struct {
-		Match     []map[string]interface{} `yaml:"match"`
-		DontMatch []map[string]interface{} `yaml:"dont-match"`
-	} `yaml:"testcases"`
+			if listsBackend(config, *fBackend) {
+				configs = append(configs, config)
+			} else {
+				excluded = append(excluded, config)
+			}
+		}
+	}
+
+	return configs, excluded, nil
 }
 
-func parseRule(contents []byte) (rule sigma.Rule, match []map[string]interface{}, dontMatch []map[string]interface{}, err error) {
-	rule, err = sigma.ParseRule(contents)
-	if err != nil {
-		return sigma.Rule{}, nil, nil, fmt.Errorf("failed to parse Rule: %w", err)
+// splitDocuments returns each of the (non-empty) YAML documents in a file re-encoded on its own
+func splitDocuments(contents []byte) ([][]byte, error) {
+	var documents [][]byte
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(document.Content) == 0 || document.Content[0].Tag == "!!null" {
+			continue
+		}
+		encoded, err := yaml.Marshal(&document)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, encoded)
 	}
+}
 
-	tc := TestCases{}
-	err = yaml.Unmarshal(contents, &tc)
-	if err != nil {
-		return sigma.Rule{}, nil, nil, fmt.Errorf("failed to parse test cases: %w", err)
+func listsBackend(config sigma.Config, backend string) bool {
+	for _, b := range config.Backends {
+		if b == backend {
+			return true
+		}
 	}
-	return rule, tc.Cases.Match, tc.Cases.DontMatch, nil
+	return false
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+func TestLoadConfigsBackend(t *testing.T) {
+	defer func(files, backend string) { *fConfigFiles, *fBackend = files, backend }(*fConfigFiles, *fBackend)
+	*fConfigFiles = "testdata/config.yaml"
+
+	configs, _, err := loadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("expected the config to be loaded, got %d configs", len(configs))
+	}
+
+	*fBackend = "some-other-backend"
+	configs, _, err = loadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 0 {
+		t.Fatalf("expected the config to be ignored for another backend, got %d configs", len(configs))
+	}
+}
+
+func TestLoadConfigsMultipleDocuments(t *testing.T) {
+	defer func(files string) { *fConfigFiles = files }(*fConfigFiles)
+	*fConfigFiles = "testdata/combined-configs.yaml"
+
+	configs, excluded, err := loadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[0].Title != "Combined config (windows)" || configs[1].Title != "Combined config (linux)" {
+		t.Fatalf("expected both configs listing the backend to be loaded in order, got %+v", configs)
+	}
+	if len(excluded) != 1 || excluded[0].Title != "Combined config (another backend)" {
+		t.Fatalf("expected the config for another backend to be excluded, got %+v", excluded)
+	}
+}
+
+func TestLoadConfigsExpandsEnv(t *testing.T) {
+	defer func(files string) { *fConfigFiles = files }(*fConfigFiles)
+	defer os.Unsetenv("SIGMA_TEST_CONFIG_DIR")
+	os.Setenv("SIGMA_TEST_CONFIG_DIR", "testdata")
+	*fConfigFiles = "${SIGMA_TEST_CONFIG_DIR}/config.yaml"
+
+	configs, _, err := loadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("expected the config to be loaded, got %d configs", len(configs))
+	}
+}
+
+func TestLoadConfigsDirectory(t *testing.T) {
+	defer func(files, dir string) { *fConfigFiles, *fConfigDir = files, dir }(*fConfigFiles, *fConfigDir)
+	dir := t.TempDir()
+	files := map[string]string{
+		"windows.yaml":           "title: Windows\nbackends:\n  - github.com/bradleyjkemp/sigma-go\nlogsources:\n  windows:\n    product: windows\nfieldmappings:\n  Image: process.executable\n",
+		"linux/linux.yml":        "title: Linux\nbackends:\n  - github.com/bradleyjkemp/sigma-go\nlogsources:\n  linux:\n    product: linux\n",
+		"linux/other.yaml":       "title: Other backend\nbackends:\n  - some-other-backend\nlogsources:\n  linux:\n    product: linux\n",
+		"docs/mappings.yaml":     "description: notes about the mappings which aren't a config\n",
+		"docs/README.md":         "# Configs\n",
+		"combined/combined.yaml": "title: First\nbackends:\n  - github.com/bradleyjkemp/sigma-go\nlogsources:\n  a:\n    category: a\n---\ntitle: Second\nbackends:\n  - github.com/bradleyjkemp/sigma-go\nlogsources:\n  b:\n    category: b\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	*fConfigFiles = ""
+	*fConfigDir = dir
+
+	configs, excluded, err := loadConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, config := range configs {
+		titles = append(titles, config.Title)
+	}
+	// Configs are loaded in walk order (i.e. sorted by path)
+	expected := []string{"First", "Second", "Linux", "Windows"}
+	if !reflect.DeepEqual(titles, expected) {
+		t.Fatalf("expected configs %v, got %v", expected, titles)
+	}
+	if len(excluded) != 1 || excluded[0].Title != "Other backend" {
+		t.Fatalf("expected the config for another backend to be excluded, got %+v", excluded)
+	}
+	if configs[3].FieldMappings["Image"].TargetNames[0] != "process.executable" {
+		t.Fatalf("expected the field mappings to be loaded, got %+v", configs[3].FieldMappings)
+	}
+}
+
+func TestSummaryOnly(t *testing.T) {
+	defer func(output string, quiet, summaryOnly bool) {
+		*fOutput, *fQuiet, *fSummaryOnly = output, quiet, summaryOnly
+	}(*fOutput, *fQuiet, *fSummaryOnly)
+	*fSummaryOnly = true
+	const summary = "1 passed, 1 failed, 0 skipped, 0 errors\n6 test cases: 5 passed, 1 failed\n"
+
+	tests := map[string]struct {
+		output     string
+		outputFile bool
+		quiet      bool
+		file       []string // lines expected in the output file (and only those with -quiet)
+	}{
+		"table":               {output: "table"},
+		"json":                {output: "json"},
+		"quiet":               {output: "table", quiet: true},
+		"table to file":       {output: "table", outputFile: true, file: []string{"testdata/events.yaml", "testdata/config-test.yaml"}},
+		"json to file":        {output: "json", outputFile: true, file: []string{`"path":"testdata/events.yaml"`, `"path":"testdata/config-test.yaml"`}},
+		"quiet table to file": {output: "table", outputFile: true, quiet: true, file: []string{"testdata/config-test.yaml"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			*fOutput, *fQuiet = tt.output, tt.quiet
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			var w io.Writer = stdout
+			file := &bytes.Buffer{}
+			if tt.outputFile {
+				w = file
+			}
+
+			out, summaryWriter, err := newOutput(w, stdout, stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &runner.Runner{OnResult: out.Report}
+			if _, err := r.Run([]string{"testdata/events.yaml", "testdata/config-test.yaml"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintln(summaryWriter, out)
+
+			if stdout.String() != summary {
+				t.Errorf("expected stdout to only contain the summary:\n%s\ngot:\n%s", summary, stdout.String())
+			}
+			if stderr.Len() > 0 {
+				t.Errorf("expected nothing on stderr, got:\n%s", stderr.String())
+			}
+			for _, line := range tt.file {
+				if !strings.Contains(file.String(), line) {
+					t.Errorf("expected the output file to contain %q:\n%s", line, file.String())
+				}
+			}
+			if tt.quiet && strings.Contains(file.String(), "testdata/events.yaml") {
+				t.Errorf("expected -quiet to leave passing rules out of the output file:\n%s", file.String())
+			}
+		})
+	}
+}
+
+func TestWriteCoverage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	report := runner.Report{Results: []runner.RuleResult{
+		{Path: "a.yaml", ID: "a", Coverage: &runner.FieldCoverage{Fields: 2, Exercised: 1, Unexercised: []string{"CommandLine"}}},
+		{Path: "b.yaml", Status: runner.StatusError},
+		{Path: "c.yaml", ID: "c", Coverage: &runner.FieldCoverage{Fields: 2, Exercised: 2}},
+	}}
+	if err := writeCoverage(path, report); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var coverage coverageFile
+	if err := json.Unmarshal(contents, &coverage); err != nil {
+		t.Fatal(err)
+	}
+	expected := coverageFile{
+		Rules: []ruleCoverage{
+			{ID: "a", Path: "a.yaml", Fields: 2, Exercised: 1, Unexercised: []string{"CommandLine"}},
+			{ID: "c", Path: "c.yaml", Fields: 2, Exercised: 2, Unexercised: []string{}},
+		},
+		Overall: overallCoverage{Rules: 2, Fields: 4, Exercised: 3, Percentage: 75},
+	}
+	if !reflect.DeepEqual(coverage, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, coverage)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.txt")
+	contents := "# rules to test\nrules/a.yaml\n\n  rules/b.yaml  \r\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"rules/a.yaml", "rules/b.yaml"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestBuildVersions(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Path: "github.com/bradleyjkemp/sigma-test", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "gopkg.in/yaml.v3", Version: "v3.0.1"},
+			{Path: sigmaGoModule, Version: "v0.5.0"},
+		},
+	}
+	if tool, sigmaGo := buildVersions(info); tool != "dev" || sigmaGo != "v0.5.0" {
+		t.Errorf("expected dev and v0.5.0, got %s and %s", tool, sigmaGo)
+	}
+
+	info.Main.Version = "v1.2.3"
+	info.Deps[1].Replace = &debug.Module{Path: "../sigma-go", Version: ""}
+	expected := "v0.5.0 (replaced by ../sigma-go)"
+	if tool, sigmaGo := buildVersions(info); tool != "v1.2.3" || sigmaGo != expected {
+		t.Errorf("expected v1.2.3 and %s, got %s and %s", expected, tool, sigmaGo)
+	}
+}
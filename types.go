@@ -1,7 +0,0 @@
-package main
-
-type TestCase struct {
-	Match *bool
-	Index string
-	Event map[string]interface{}
-}
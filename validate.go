@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bradleyjkemp/sigma-go"
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+// validateConfigs prints a description of the logsource and field mappings in each config,
+// returning whether they're all consistent
+func validateConfigs(configs []sigma.Config, w io.Writer) bool {
+	valid := true
+	for i, config := range configs {
+		name := config.Title
+		if name == "" {
+			name = fmt.Sprintf("config %d", i+1)
+		}
+		fmt.Fprintf(w, "%s:\n", name)
+
+		fmt.Fprintln(w, "  logsources:")
+		for _, logsourceName := range logsourceNames(config) {
+			logsource := config.Logsources[logsourceName]
+			fmt.Fprintf(w, "    %s: %s", logsourceName, describeLogsource(logsource.Logsource))
+			if len(logsource.Index) > 0 {
+				fmt.Fprintf(w, " -> index %s", strings.Join(logsource.Index, ", "))
+			}
+			if rewrite := describeLogsource(logsource.Rewrite); rewrite != "" {
+				fmt.Fprintf(w, " -> rewritten to %s", rewrite)
+			}
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintln(w, "  fieldmappings:")
+		var fields []string
+		for field := range config.FieldMappings {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Fprintf(w, "    %s -> %s\n", field, strings.Join(config.FieldMappings[field].TargetNames, ", "))
+		}
+
+		for _, problem := range configProblems(config, configs) {
+			valid = false
+			fmt.Fprintf(w, "  WARNING: %s\n", problem)
+		}
+	}
+	return valid
+}
+
+// configProblems finds logsource conditions using fields that aren't mapped and
+// logsource rewrites which aren't handled by any of the loaded configs
+func configProblems(config sigma.Config, configs []sigma.Config) []string {
+	var problems []string
+	for _, logsourceName := range logsourceNames(config) {
+		logsource := config.Logsources[logsourceName]
+		for _, matcher := range logsource.Conditions.EventMatchers {
+			for _, field := range matcher {
+				if _, mapped := config.FieldMappings[field.Field]; !mapped {
+					problems = append(problems, fmt.Sprintf("logsource %s has a condition on field %s which has no field mapping", logsourceName, field.Field))
+				}
+			}
+		}
+
+		if describeLogsource(logsource.Rewrite) != "" && !logsourceHandled(logsource.Rewrite, configs) {
+			problems = append(problems, fmt.Sprintf("logsource %s is rewritten to %s which doesn't match any logsource in the loaded configs", logsourceName, describeLogsource(logsource.Rewrite)))
+		}
+	}
+	return problems
+}
+
+func logsourceHandled(rewrite sigma.Logsource, configs []sigma.Config) bool {
+	for _, config := range configs {
+		for _, logsource := range config.Logsources {
+			if runner.LogsourceMatches(logsource.Logsource, rewrite) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeLogsource(logsource sigma.Logsource) string {
+	var parts []string
+	if logsource.Product != "" {
+		parts = append(parts, "product="+logsource.Product)
+	}
+	if logsource.Category != "" {
+		parts = append(parts, "category="+logsource.Category)
+	}
+	if logsource.Service != "" {
+		parts = append(parts, "service="+logsource.Service)
+	}
+	return strings.Join(parts, " ")
+}
+
+func logsourceNames(config sigma.Config) []string {
+	var names []string
+	for name := range config.Logsources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/bradleyjkemp/sigma-go"
+)
+
+func TestValidateConfigs(t *testing.T) {
+	contents, err := os.ReadFile("testdata/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := sigma.ParseConfig(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid, err := sigma.ParseConfig([]byte(`
+logsources:
+  sysmon:
+    product: windows
+    service: sysmon
+    conditions:
+      EventLog: Microsoft-Windows-Sysmon/Operational
+    rewrite:
+      product: windows
+      category: process_creation
+fieldmappings:
+  Image: process.executable
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		configs []sigma.Config
+		valid   bool
+		output  string
+	}{
+		"valid": {
+			configs: []sigma.Config{valid},
+			valid:   true,
+			output: `Test Config:
+  logsources:
+    test-events: category=test
+  fieldmappings:
+    Bar -> $.bar
+    Foo -> $.foo
+`,
+		},
+		"invalid": {
+			configs: []sigma.Config{invalid},
+			valid:   false,
+			output: `config 1:
+  logsources:
+    sysmon: product=windows service=sysmon -> rewritten to product=windows category=process_creation
+  fieldmappings:
+    Image -> process.executable
+  WARNING: logsource sysmon has a condition on field EventLog which has no field mapping
+  WARNING: logsource sysmon is rewritten to product=windows category=process_creation which doesn't match any logsource in the loaded configs
+`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if validateConfigs(tt.configs, buf) != tt.valid {
+				t.Errorf("expected validateConfigs to return %v", tt.valid)
+			}
+			if buf.String() != tt.output {
+				t.Errorf("expected output:\n%s\ngot:\n%s", tt.output, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+)
+
+// version is the version of sigma-test, set at build time with -ldflags "-X main.version=v1.2.3".
+// If it's not set, the version of the module recorded in the binary's build info (e.g. by go install) is used instead.
+var version = ""
+
+const sigmaGoModule = "github.com/bradleyjkemp/sigma-go"
+
+// printVersion prints the version of sigma-test along with the versions of sigma-go and Go it was built with
+func printVersion(w io.Writer) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		info = &debug.BuildInfo{}
+	}
+	toolVersion, sigmaGoVersion := buildVersions(info)
+	fmt.Fprintf(w, "sigma-test %s\n", toolVersion)
+	fmt.Fprintf(w, "sigma-go %s\n", sigmaGoVersion)
+	if info.GoVersion != "" {
+		fmt.Fprintf(w, "go %s\n", info.GoVersion)
+	}
+}
+
+// buildVersions returns the versions of sigma-test and of the sigma-go module it was built with (taking into account any replace directive)
+func buildVersions(info *debug.BuildInfo) (string, string) {
+	toolVersion := version
+	if toolVersion == "" {
+		toolVersion = info.Main.Version
+	}
+	if toolVersion == "" || toolVersion == "(devel)" {
+		// Built from a checkout (e.g. with go build) so there's no module version to report
+		toolVersion = "dev"
+	}
+
+	sigmaGoVersion := "unknown"
+	for _, dep := range info.Deps {
+		if dep.Path != sigmaGoModule {
+			continue
+		}
+		sigmaGoVersion = dep.Version
+		if dep.Replace != nil {
+			// Local replacements (e.g. ../sigma-go) don't have a version
+			sigmaGoVersion = strings.TrimSpace(fmt.Sprintf("%s (replaced by %s %s", dep.Version, dep.Replace.Path, dep.Replace.Version)) + ")"
+		}
+	}
+	return toolVersion, sigmaGoVersion
+}
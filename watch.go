@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Editors often write a file several times when saving so wait for changes to settle before re-running
+const watchDebounce = 100 * time.Millisecond
+
+// watch re-tests rules whenever they (or their test files) change.
+// It only returns if watching fails.
+func watch(paths []string, r *runner.Runner, w io.Writer) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+
+	// Test files outside the directories being tested need watching too
+	roots := paths
+	if r.TestDir != "" {
+		roots = append(roots[:len(roots):len(roots)], r.TestDir)
+	}
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				if path == root {
+					return watcher.Add(path)
+				}
+				return nil
+			}
+			if !watchesDir(r, root, path) {
+				return filepath.SkipDir
+			}
+			return watcher.Add(path)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", root, err)
+		}
+	}
+
+	changed := map[string]bool{}
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 && r.Recursive && !r.Filter.Excluded(event.Name) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watcher.Add(event.Name)
+					continue
+				}
+			}
+			rule, ok := changedRule(r, event.Name)
+			if !ok {
+				continue
+			}
+			changed[rule] = true
+			debounce.Reset(watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("error watching files: %w", err)
+
+		case <-debounce.C:
+			// Errors go to stderr (as the banner does) so that machine-readable output on w isn't corrupted
+			if err := rerun(changed, r, w, os.Stdout, os.Stderr); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			changed = map[string]bool{}
+		}
+	}
+}
+
+// watchesDir checks whether a directory found under root should be watched (the same directories are tested)
+func watchesDir(r *runner.Runner, root, path string) bool {
+	return path == root || (r.Recursive && !r.Filter.Excluded(path))
+}
+
+// changedRule returns the rule to re-run when the file at path changes, if it could be a rule or test file which isn't excluded
+func changedRule(r *runner.Runner, path string) (string, bool) {
+	if !r.MatchesRulePattern(path) || r.Filter.Excluded(path) {
+		return "", false
+	}
+	// The rule may have been created since the listings were cached
+	r.RefreshListings()
+	return r.RuleFilename(path), true
+}
+
+// rerun re-tests the changed rules, reporting the results as the first run did (see newOutput)
+func rerun(changed map[string]bool, r *runner.Runner, w, stdout, stderr io.Writer) error {
+	var paths []string
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintf(stderr, "\n[%s] re-running %s\n", time.Now().Format("15:04:05"), strings.Join(paths, ", "))
+	out, summary, err := newOutput(w, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	rerunner := *r
+	rerunner.OnResult = out.Report
+	// A changed file which isn't a rule (e.g. a test file without a rule) has nothing to re-run
+	rerunner.AllowEmpty = true
+	for _, path := range paths {
+		_, err := rerunner.Run([]string{path})
+		if errors.Is(err, fs.ErrNotExist) {
+			// The rule has been deleted (or this was a test file without a rule)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(summary, out)
+	return r.Cache.Save()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradleyjkemp/sigma-test/runner"
+)
+
+func TestWatchExcludes(t *testing.T) {
+	r := &runner.Runner{Recursive: true, Filter: runner.Filter{Excludes: []string{"deprecated", "*_old.yaml"}}}
+	root := "rules"
+
+	dirs := map[string]bool{
+		root:                                   true,
+		filepath.Join(root, "windows"):         true,
+		filepath.Join(root, "deprecated"):      false,
+		filepath.Join(root, "a", "deprecated"): false,
+	}
+	for dir, watched := range dirs {
+		if watchesDir(r, root, dir) != watched {
+			t.Errorf("expected watchesDir(%q) to be %v", dir, watched)
+		}
+	}
+
+	files := map[string]string{
+		"rules/rule.yaml":     "rules/rule.yaml",
+		"rules/rule_old.yaml": "",
+		"rules/notes.txt":     "",
+	}
+	for path, expected := range files {
+		rule, ok := changedRule(r, path)
+		if ok != (expected != "") || rule != expected {
+			t.Errorf("expected changedRule(%q) to be %q, got %q (%v)", path, expected, rule, ok)
+		}
+	}
+
+	// Without -recursive only the root is watched
+	if watchesDir(&runner.Runner{}, root, filepath.Join(root, "windows")) {
+		t.Error("expected subdirectories not to be watched without -recursive")
+	}
+}
+
+func TestRerunOutput(t *testing.T) {
+	defer func(output string, quiet, summaryOnly, groupByDir bool) {
+		*fOutput, *fQuiet, *fSummaryOnly, *fGroupByDir = output, quiet, summaryOnly, groupByDir
+	}(*fOutput, *fQuiet, *fSummaryOnly, *fGroupByDir)
+	changed := map[string]bool{"testdata/events.yaml": true, "testdata/config-test.yaml": true}
+	const summary = "1 passed, 1 failed, 0 skipped, 0 errors\n6 test cases: 5 passed, 1 failed\n"
+
+	tests := map[string]struct {
+		output                         string
+		quiet, summaryOnly, groupByDir bool
+		stdout                         func(t *testing.T, stdout string) // checks that stdout only contains the reporter's output
+		stderr                         []string                          // expected to be in stderr
+	}{
+		"default": {
+			output: "table",
+			stdout: func(t *testing.T, stdout string) {
+				if !strings.HasPrefix(stdout, "testdata/config-test.yaml") || !strings.Contains(stdout, "testdata/events.yaml") {
+					t.Errorf("expected only the results on stdout:\n%s", stdout)
+				}
+			},
+			stderr: []string{"re-running testdata/config-test.yaml, testdata/events.yaml", summary},
+		},
+		"json": {
+			output: "json",
+			stdout: func(t *testing.T, stdout string) {
+				var results []jsonResult
+				if err := json.Unmarshal([]byte(stdout), &results); err != nil || len(results) != 2 {
+					t.Errorf("expected stdout to be the JSON results (%v):\n%s", err, stdout)
+				}
+			},
+			stderr: []string{"re-running", summary},
+		},
+		"quiet": {
+			output: "table",
+			quiet:  true,
+			stdout: func(t *testing.T, stdout string) {
+				if !strings.HasPrefix(stdout, "testdata/config-test.yaml") || strings.Contains(stdout, "events.yaml") {
+					t.Errorf("expected only the failing rule on stdout:\n%s", stdout)
+				}
+			},
+			stderr: []string{"re-running", summary},
+		},
+		"summary only": {
+			output:      "table",
+			summaryOnly: true,
+			stdout: func(t *testing.T, stdout string) {
+				if stdout != summary {
+					t.Errorf("expected only the summary on stdout:\n%s", stdout)
+				}
+			},
+			stderr: []string{"re-running"},
+		},
+		"group by dir": {
+			output:     "table",
+			groupByDir: true,
+			stdout:     func(t *testing.T, stdout string) {},
+			stderr:     []string{"re-running", "results by directory:"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			*fOutput, *fQuiet, *fSummaryOnly, *fGroupByDir = tt.output, tt.quiet, tt.summaryOnly, tt.groupByDir
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			if err := rerun(changed, &runner.Runner{}, stdout, stdout, stderr); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(stdout.String(), "re-running") {
+				t.Errorf("expected the banner to go to stderr:\n%s", stdout.String())
+			}
+			tt.stdout(t, stdout.String())
+			for _, s := range tt.stderr {
+				if !strings.Contains(stderr.String(), s) {
+					t.Errorf("expected stderr to contain %q:\n%s", s, stderr.String())
+				}
+			}
+		})
+	}
+}
+
+func TestChangedRuleCreatedWhileWatching(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("detection:\n  selection:\n    a: foo\n  condition: selection\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("existing.yaml")
+	r := &runner.Runner{}
+	if _, err := r.Run([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither file was in the directory when the listings were cached by the initial run
+	rule := write("new.yaml")
+	if changed, ok := changedRule(r, write("new_extra_test.yaml")); !ok || changed != rule {
+		t.Fatalf("expected the additional test file to re-run %s, got %q (%v)", rule, changed, ok)
+	}
+}